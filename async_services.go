@@ -1,12 +1,18 @@
 package workflow
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// FutureStage is the stage of a Future, it moves NOT_STARTED -> SUBMITTED -> RUNNING -> TARGET_INVOKED -> COMPLETED.
+// It can be ABORTED or TIMEDOUT until the target function returns, or REJECTED by the executor once SUBMITTED.
+// ABORTED, TIMEDOUT, COMPLETED and REJECTED are final, a future that reached one of them never changes its stage.
 type FutureStage int
 
 const (
@@ -17,6 +23,14 @@ const (
 	TIMEDOUT
 	TARGET_INVOKED
 	COMPLETED
+	REJECTED
+)
+
+var (
+	ErrAborted  = errors.New("aborted")
+	ErrTimedOut = errors.New("timedout")
+
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
 )
 
 type Future struct {
@@ -24,21 +38,35 @@ type Future struct {
 	paramsPassed []interface{}
 	funcReturned []interface{}
 	voidReturn   bool
-	rC           chan interface{} //response channel
-	aC           chan error       //abort channel
-	abortOnce    sync.Once
+	injectCtx    bool                            //context of the future is passed as the first argument of the target function
+	injectState  bool                            //state of the flow is passed after the context, see FlowState
+	manual       bool                            //completed by a Promise instead of a target function
+	detached     bool                            //submitted by a callback, which does not wait for space in the queue, see dispatchDetached()
+	timesOut     bool                            //the deadline of the ctx moves the future to TIMEDOUT instead of ABORTED, used by the steps of a Flow
+	deps         []*Future                       //futures executed along with this future
+	trigger      func()                          //called by Execute() instead of submitting the target function, it submits it later
+	around       func(call func() []interface{}) //wraps the call of the target function, which is skipped if call is not called
+	parentCtx    context.Context                 //ctx the future is created with
+	ctx          context.Context                 //cancelled when the future is done
+	cancelCtx    context.CancelFunc
+	done         chan struct{} //closed when the future reaches COMPLETED, ABORTED, TIMEDOUT or REJECTED
 	runOnce      sync.Once
-	stage        FutureStage
+	stage        int32 //FutureStage, changed only through transition()
 	es           *ExecutorService
+	err          error
+	callbackES   *ExecutorService //runs the callbacks, es is used if not set
+	callbackMu   sync.Mutex
+	callbacks    []func() //run once the future is done
 }
 
-func newFuture() *Future {
+func newFuture(ctx context.Context) *Future {
 
 	f := &Future{}
-	f.rC = make(chan interface{})
-	f.stage = NOT_STARTED
-	f.aC = make(chan error, 1)
+	f.done = make(chan struct{})
+	f.stage = int32(NOT_STARTED)
 	f.es = default_es
+	f.parentCtx = ctx
+	f.ctx, f.cancelCtx = context.WithCancel(ctx)
 
 	return f
 }
@@ -52,135 +80,456 @@ func (f *Future) SetExecutor(customExecutor *ExecutorService) *Future {
 // Return from this method indicates successful execution of target function or time-out or user aborted/cancelled this future.
 // error is returned in case of timeouts or aborted.
 // The return values of the target function is returned as array of interface{}.
+// Get() can be called any number of times, by any number of goroutines, once the future is done the same result is returned.
 func (f *Future) Get(timeout time.Duration) ([]interface{}, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		tmr := time.NewTimer(timeout)
+		defer tmr.Stop()
+		expired = tmr.C
+	}
+	return f.await(context.Background(), expired)
+}
 
-	if f.stage == ABORTED || f.stage == TIMEDOUT || f.stage == COMPLETED {
-		switch f.stage {
-		case ABORTED:
-			return nil, fmt.Errorf("ABORTED")
-		case TIMEDOUT:
-			return nil, fmt.Errorf("TIMEDOUT")
-		case COMPLETED:
-			return nil, fmt.Errorf("COMPLETED ALREADY")
-		}
+// GetCtx is same as Get() but waits until the ctx is done instead of a timeout.
+// The future is cancelled if the ctx is done before the target function invocation is completed.
+func (f *Future) GetCtx(ctx context.Context) ([]interface{}, error) {
+	return f.await(ctx, nil)
+}
+
+func (f *Future) await(ctx context.Context, expired <-chan time.Time) ([]interface{}, error) {
+	select {
+	case <-f.done:
+	case <-expired:
+		f.finish(TIMEDOUT, nil, ErrTimedOut)
+	case <-ctx.Done():
+		f.finish(ABORTED, nil, ctx.Err())
+	case <-f.ctx.Done():
+		f.finish(f.ctxStage(f.ctx.Err()), nil, f.ctx.Err())
 	}
 
-	if timeout > 0 {
-		start := time.Now()
-		tmr := time.NewTimer(timeout)
-		select {
-		case <-f.aC:
-			fmt.Errorf("Aborted target (%+v)", reflect.TypeOf(f.targetFunc))
-			f.funcReturned = nil
-			return nil, fmt.Errorf("aborted")
-		case <-tmr.C:
-			end := time.Since(start).Milliseconds()
-			fmt.Errorf("Timeout (%d) got triggered hence aborting target (%+v)", end, reflect.TypeOf(f.targetFunc))
-			f.abortOnce.Do(f.abort)
-			f.funcReturned = nil
-			tmr.Stop()
-			return nil, fmt.Errorf("timedout")
-		case <-f.rC:
-			tmr.Stop()
-			f.stage = COMPLETED
-			return f.funcReturned, nil
-		}
-	} else {
-		select {
-		case <-f.aC:
-			fmt.Errorf("Aborted target (%+v)", reflect.TypeOf(f.targetFunc))
-			f.funcReturned = nil
-			return nil, fmt.Errorf("aborted")
-		case <-f.rC:
-			f.stage = COMPLETED
-			return f.funcReturned, nil
-		}
+	<-f.done
+	return f.funcReturned, f.err
+}
+
+// Done returns a channel that is closed when the future is completed, aborted, timedout or rejected.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err returns the reason the future failed, nil if the future is not done yet or completed successfully.
+func (f *Future) Err() error {
+	select {
+	case <-f.done:
+		return f.err
+	default:
+		return nil
 	}
+}
 
+// Result returns the return values of the target function, nil if the future is not done yet or failed.
+func (f *Future) Result() []interface{} {
+	select {
+	case <-f.done:
+		return f.funcReturned
+	default:
+		return nil
+	}
 }
 
 // Cancel's the referred future, sends a signal to abort the call of target function.
 // This method returns immediately.
-// Call to Cancel() does not mean the target function is aborted if it is running already.
+// Call to Cancel() does not mean the target function is aborted if it is running already,
+// unless the target function accepts a context.Context as its first parameter, which is cancelled.
 // Target function will not be called if it is not triggered yet when Cancel() is called.
-// Any call to *Future.Get() after Cancel() is invoked will return an error indicating aborted
+// Any call to *Future.Get() after Cancel() is invoked will return an error indicating aborted.
+// Returns false if the future is done already.
 func (f *Future) Cancel() bool {
-	if f.stage == COMPLETED {
-		return false
+	return f.finish(ABORTED, nil, ErrAborted)
+}
+
+// finish moves the future to its final stage, returns false if the future is done already.
+// The stage is changed first, the result is visible once Done() is closed.
+func (f *Future) finish(stage FutureStage, returned []interface{}, err error) bool {
+	finished := f.transition(stage)
+	if finished {
+		f.funcReturned = returned
+		f.err = err
+		close(f.done)
+
+		f.callbackMu.Lock()
+		callbacks := f.callbacks
+		f.callbacks = nil
+		f.callbackMu.Unlock()
+		for _, callback := range callbacks {
+			f.runCallback(callback)
+		}
+	}
+	f.cancelCtx()
+	return finished
+}
+
+// OnComplete registers fn to be called with the return values of the target function once the future completes successfully.
+// Callbacks are run on the executor of the future, unless changed by SetCallbackExecutor(), a callback registered
+// after the future is done is submitted right away.
+func (f *Future) OnComplete(fn func(returned []interface{})) *Future {
+	f.whenDone(func() {
+		if f.Stage() == COMPLETED && f.err == nil {
+			fn(f.funcReturned)
+		}
+	})
+	return f
+}
+
+// OnError registers fn to be called with the reason the future failed, i.e. the target function panicked,
+// the future TIMEDOUT, was REJECTED or the Promise failed. See OnComplete() for how the callbacks are run.
+func (f *Future) OnError(fn func(err error)) *Future {
+	f.whenDone(func() {
+		if f.Stage() != ABORTED && f.err != nil {
+			fn(f.err)
+		}
+	})
+	return f
+}
+
+// OnCancel registers fn to be called once the future is ABORTED. See OnComplete() for how the callbacks are run.
+func (f *Future) OnCancel(fn func()) *Future {
+	f.whenDone(func() {
+		if f.Stage() == ABORTED {
+			fn()
+		}
+	})
+	return f
+}
+
+// SetCallbackExecutor changes the executor the callbacks of the future are run on.
+func (f *Future) SetCallbackExecutor(callbackExecutor *ExecutorService) *Future {
+	f.callbackMu.Lock()
+	f.callbackES = callbackExecutor
+	f.callbackMu.Unlock()
+	return f
+}
+
+// whenDone runs the callback once the future is done, on the callback executor.
+func (f *Future) whenDone(callback func()) {
+	f.callbackMu.Lock()
+	select {
+	case <-f.done:
+		f.callbackMu.Unlock()
+		f.runCallback(callback)
+	default:
+		f.callbacks = append(f.callbacks, callback)
+		f.callbackMu.Unlock()
+	}
+}
+
+func (f *Future) runCallback(callback func()) {
+	f.callbackMu.Lock()
+	es := f.callbackES
+	f.callbackMu.Unlock()
+	if es == nil {
+		es = f.es
 	}
-	f.abortOnce.Do(f.abort)
-	f.stage = ABORTED
-	return true
+	es.submitCallback(callback)
 }
 
-func (f *Future) abort() {
-	fmt.Errorf("Cancelling target (%+v)", reflect.TypeOf(f.targetFunc))
-	f.aC <- fmt.Errorf("aborted")
+// transition moves the future to the stage atomically, returns false if the move is not valid from the current stage.
+func (f *Future) transition(to FutureStage) bool {
+	for {
+		from := f.Stage()
+		if !validTransition(from, to) {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&f.stage, int32(from), int32(to)) {
+			return true
+		}
+	}
+}
+
+// validTransition reports if a future can move from one stage to the other,
+// ABORTED, TIMEDOUT, COMPLETED and REJECTED are final.
+func validTransition(from, to FutureStage) bool {
+	switch from {
+	case NOT_STARTED:
+		return to == SUBMITTED || to == ABORTED || to == TIMEDOUT
+	case SUBMITTED:
+		return to == RUNNING || to == ABORTED || to == TIMEDOUT || to == REJECTED
+	case RUNNING:
+		return to == TARGET_INVOKED || to == COMPLETED || to == ABORTED || to == TIMEDOUT
+	case TARGET_INVOKED:
+		return to == COMPLETED
+	default:
+		return false
+	}
 }
 
 func (f *Future) Stage() FutureStage {
-	return f.stage
+	return FutureStage(atomic.LoadInt32(&f.stage))
 }
 
 func (f *Future) callTarget() []reflect.Value {
 	targetType := reflect.TypeOf(f.targetFunc)
 	valueOf := reflect.ValueOf(f.targetFunc)
 	methodParams := make([]reflect.Value, 0, targetType.NumIn())
-	for i, p := range f.paramsPassed {
+	if f.injectCtx {
+		methodParams = append(methodParams, reflect.ValueOf(f.ctx))
+	}
+	if f.injectState {
+		state := stateOf(f.ctx)
+		if state == nil {
+			state = newFlowState() //the future is not run by a flow
+		}
+		methodParams = append(methodParams, reflect.ValueOf(state))
+	}
+	for _, p := range f.paramsPassed {
 		paramValue := reflect.ValueOf(p)
 		if paramValue.Kind() == reflect.Invalid {
-			paramValue = reflect.Zero(targetType.In(i))
+			paramValue = reflect.Zero(paramType(targetType, len(methodParams)))
 		}
 		methodParams = append(methodParams, paramValue)
 	}
 
-	fmt.Printf("Calling Target %s  no. of args = %d, no. of args passed = %d\n", valueOf.String(), targetType.NumIn(), len(methodParams))
 	return valueOf.Call(methodParams)
 }
 
-func (f *Future) executeTarget() {
-	defer close(f.rC)
+// paramType returns the type of i'th parameter of the target function, considering the variadic parameter.
+func paramType(targetType reflect.Type, i int) reflect.Type {
+	if targetType.IsVariadic() && i >= targetType.NumIn()-1 {
+		return targetType.In(targetType.NumIn() - 1).Elem()
+	}
+	return targetType.In(i)
+}
 
-	if len(f.aC) != 0 {
-		return
+// injectsContext reports if a context.Context has to be passed as the first argument of the target function,
+// which is the case when the first parameter is a context.Context and it is not part of the arguments passed.
+// A nil entry in argTypes represents an untyped nil argument.
+func injectsContext(targetType reflect.Type, argTypes []reflect.Type) bool {
+	if targetType.NumIn() == 0 || targetType.In(0) != contextType {
+		return false
+	}
+	if len(argTypes) == 0 {
+		return true
 	}
-	f.stage = RUNNING
-	returned := f.callTarget()
-	f.stage = TARGET_INVOKED
-	for _, r := range returned {
-		f.funcReturned = append(f.funcReturned, r.Interface())
+	if argTypes[0] != nil && argTypes[0].Implements(contextType) {
+		return false
+	}
+	return !(argTypes[0] == nil && len(argTypes) == targetType.NumIn())
+}
+
+func typesOf(args []interface{}) []reflect.Type {
+	argTypes := make([]reflect.Type, 0, len(args))
+	for _, arg := range args {
+		argTypes = append(argTypes, reflect.TypeOf(arg))
+	}
+	return argTypes
+}
+
+// validateArgs checks that the target function can be called with arguments of argTypes,
+// a nil entry in argTypes represents an untyped nil argument.
+func validateArgs(targetType reflect.Type, argTypes []reflect.Type) error {
+	offset := 0
+	if injectsContext(targetType, argTypes) {
+		offset = 1
 	}
+	if injectsState(targetType, argTypes) {
+		offset++
+	}
+	expected := targetType.NumIn() - offset
+	if targetType.IsVariadic() {
+		if len(argTypes) < expected-1 {
+			return fmt.Errorf("mismatch in number of arguments, expected at least = %d, passed = %d", expected-1, len(argTypes))
+		}
+	} else if len(argTypes) != expected {
+		return fmt.Errorf("mismatch in number of arguments, expected = %d, passed = %d", expected, len(argTypes))
+	}
+
+	for i, argType := range argTypes {
+		pType := paramType(targetType, i+offset)
+		if argType == nil {
+			switch pType.Kind() {
+			case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map, reflect.Ptr, reflect.Slice:
+				continue
+			}
+			return fmt.Errorf("argument %d is nil, parameter of type %s can not be nil", i, pType)
+		}
+		if !argType.AssignableTo(pType) {
+			return fmt.Errorf("argument %d of type %s is not assignable to parameter of type %s", i, argType, pType)
+		}
+	}
+	return nil
+}
 
+func (f *Future) executeTarget() {
+	if !f.transition(RUNNING) {
+		return
+	}
+	if err := f.ctx.Err(); err != nil {
+		f.finish(f.ctxStage(err), nil, err)
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr := newPanicError(r)
+			f.finish(COMPLETED, nil, panicErr)
+			f.es.handlePanic(panicErr)
+		}
+	}()
+	var funcReturned []interface{}
+	called := false
+	call := func() []interface{} {
+		returned := f.callTarget()
+		funcReturned = make([]interface{}, 0, len(returned))
+		for _, r := range returned {
+			funcReturned = append(funcReturned, r.Interface())
+		}
+		called = true
+		return funcReturned
+	}
+	if f.around != nil {
+		f.around(call)
+	} else {
+		call()
+	}
+	if !called {
+		f.finish(ABORTED, nil, ErrAborted)
+		return
+	}
+	if err := f.ctx.Err(); err != nil {
+		//the ctx was done while the target function was running, its results are dropped
+		f.finish(f.ctxStage(err), nil, err)
+		return
+	}
+	if !f.transition(TARGET_INVOKED) {
+		return
+	}
+	f.finish(COMPLETED, funcReturned, nil)
 }
 
 // This has to be called to trigger the execution of the target function by a GOROUTINE.
 // The target function will not be executed unless this method is invoked.
 func (f *Future) Execute() *Future {
-	if f.stage != NOT_STARTED {
-		return f
-	}
 	f.runOnce.Do(func() {
-		f.es.Submit(f.executeTarget)
+		for _, dep := range f.deps {
+			dep.Execute()
+		}
+		if !f.transition(SUBMITTED) || f.manual {
+			return
+		}
+		if f.trigger != nil {
+			f.trigger()
+			return
+		}
+		f.submit()
 	})
-	f.stage = SUBMITTED
 	return f
 }
 
+func (f *Future) submit() {
+	dispatch := f.es.dispatch
+	if f.detached {
+		dispatch = f.es.dispatchDetached
+	}
+	if err := dispatch(&job{run: f.executeTarget, reject: f.reject}); err != nil {
+		f.reject(err)
+	}
+}
+
+// settle completes the future with the values, or fails it with err, without calling the target function.
+// Returns false if the future is done already.
+func (f *Future) settle(values []interface{}, err error) bool {
+	f.transition(SUBMITTED)
+	if !f.transition(RUNNING) {
+		return false
+	}
+	if values == nil && err == nil {
+		values = []interface{}{}
+	}
+	return f.finish(COMPLETED, values, err)
+}
+
+// adopt settles the future with the outcome of the other future, which is done already.
+// An ABORTED future aborts this one, any other failure fails it with the same error.
+func (f *Future) adopt(other *Future) {
+	if other.Stage() == ABORTED {
+		f.finish(f.ctxStage(other.err), nil, other.err)
+	} else {
+		f.settle(other.funcReturned, other.err)
+	}
+}
+
+// ctxStage returns the stage the future moves to when its ctx is done with err.
+func (f *Future) ctxStage(err error) FutureStage {
+	if f.timesOut && errors.Is(err, context.DeadlineExceeded) {
+		return TIMEDOUT
+	}
+	return ABORTED
+}
+
+// release drops the return values of the future once they are consumed, e.g. folded by a REDUCE step of a Flow.
+// The caller makes sure nobody else reads them, Get() and Result() return nil values afterwards.
+func (f *Future) release() {
+	f.funcReturned = nil
+}
+
+// invoke calls the target function on the calling goroutine, the way a future calls it, a panic is returned as a *PanicError.
+func invoke(ctx context.Context, targetFunc interface{}, args []interface{}) (returned []interface{}, err error) {
+	if err := validateArgs(reflect.TypeOf(targetFunc), typesOf(args)); err != nil {
+		return nil, err
+	}
+	f, err := RunAsyncCtx(ctx, targetFunc, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer f.cancelCtx()
+	defer func() {
+		if r := recover(); r != nil {
+			returned, err = nil, newPanicError(r)
+		}
+	}()
+	for _, r := range f.callTarget() {
+		returned = append(returned, r.Interface())
+	}
+	return returned, nil
+}
+
+// reject moves the future to REJECTED when the executor will never run its target function.
+func (f *Future) reject(err error) {
+	f.finish(REJECTED, nil, err)
+}
+
 // This method creates a Future that represents the async execution of the target function.
 // Execute() should be called on the returned future to trigger the execution of the target function.
 func RunAsync(targetFunc interface{}, args ...interface{}) (*Future, error) {
+	return RunAsyncCtx(context.Background(), targetFunc, args...)
+}
+
+// Same as RunAsync(), the future is aborted when the ctx is done.
+// If the first parameter of the target function is a context.Context and it is not passed in args,
+// a context derived from ctx is passed which is cancelled when the future is cancelled or timedout.
+// If the ctx is done while the target function is running, the future is ABORTED and the results are dropped.
+func RunAsyncCtx(ctx context.Context, targetFunc interface{}, args ...interface{}) (*Future, error) {
 	targetType := reflect.TypeOf(targetFunc)
 	switch targetType.Kind() {
 	case reflect.Func:
-		if targetType.NumIn() != len(args) && !targetType.IsVariadic() {
-			fmt.Errorf("mismatch in number of arguments, expected = %d, passed = %d", targetType.NumIn(), len(args))
-			return nil, fmt.Errorf("mismatch in number of arguments, expected = %d, passed = %d", targetType.NumIn(), len(args))
+		injectCtx := injectsContext(targetType, typesOf(args))
+		injectState := injectsState(targetType, typesOf(args))
+		expected := targetType.NumIn()
+		if injectCtx {
+			expected--
+		}
+		if injectState {
+			expected--
+		}
+		if expected != len(args) && !targetType.IsVariadic() {
+			return nil, fmt.Errorf("mismatch in number of arguments, expected = %d, passed = %d", expected, len(args))
 		}
 
-		future := newFuture()
+		future := newFuture(ctx)
 		future.targetFunc = targetFunc
 		future.paramsPassed = args
 		future.voidReturn = targetType.NumOut() == 0
+		future.injectCtx = injectCtx
+		future.injectState = injectState
 		return future, nil
 	default:
 		return nil, fmt.Errorf("%s un-supported type", targetType.Kind())
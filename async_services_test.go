@@ -1,7 +1,10 @@
 package workflow
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -27,10 +30,10 @@ func TestFuture_Execute_VariadicArgs(t *testing.T) {
 }
 
 func TestFuture_Execute_RunOnce(t *testing.T) {
-	counter := 1
+	counter := int32(1)
 
 	if future, err := RunAsync(func() {
-		counter = counter - 1
+		atomic.AddInt32(&counter, -1)
 	}); err != nil {
 		t.Errorf("error (%s) creating future", err.Error())
 	} else {
@@ -41,8 +44,8 @@ func TestFuture_Execute_RunOnce(t *testing.T) {
 			future.Execute()
 		}()
 		<-time.After(1 * time.Second)
-		if counter < 0 {
-			t.Errorf("target func ran twice!!, expected counter=0 but it is set to %d", counter)
+		if ran := atomic.LoadInt32(&counter); ran < 0 {
+			t.Errorf("target func ran twice!!, expected counter=0 but it is set to %d", ran)
 		}
 	}
 }
@@ -98,6 +101,328 @@ func TestFuture_Execute_NilMethodParam(t *testing.T) {
 	}
 }
 
+func TestFuture_Get_Panic(t *testing.T) {
+	es := NewExecutorService(1, 1)
+	defer es.Shutdown()
+	handled := make(chan *PanicError, 1)
+	es.SetPanicHandler(func(p *PanicError) {
+		handled <- p
+	})
+
+	if future, err := RunAsync(func() bool {
+		panic("boom")
+	}); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else {
+		future.SetExecutor(es).Execute()
+		_, err := future.Get(time.Second)
+		if panicErr, ok := err.(*PanicError); !ok || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+			t.Errorf("expected a PanicError but got %v", err)
+		}
+		if p := <-handled; p.Value != "boom" {
+			t.Errorf("expected panic handler to be called with boom but got %v", p.Value)
+		}
+	}
+
+	if future, err := RunAsync(func() bool {
+		return true
+	}); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else if get, err := future.SetExecutor(es).Execute().Get(time.Second); err != nil || get[0] != true {
+		t.Errorf("expected the worker to survive the panic but got %v, %v", get, err)
+	}
+}
+
+func TestFuture_Cancel_StopsContextTarget(t *testing.T) {
+	stopped := make(chan error, 1)
+	if future, err := RunAsync(func(ctx context.Context) bool {
+		select {
+		case <-ctx.Done():
+			stopped <- ctx.Err()
+			return false
+		case <-time.After(time.Second):
+			stopped <- nil
+			return true
+		}
+	}); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else {
+		future.Execute()
+		time.AfterFunc(10*time.Millisecond, func() {
+			future.Cancel()
+		})
+		if _, err := future.Get(0); err == nil {
+			t.Errorf("expected an error!!!")
+		}
+		select {
+		case err := <-stopped:
+			if err != context.Canceled {
+				t.Errorf("expected the target to be cancelled but got %v", err)
+			}
+		case <-time.After(1500 * time.Millisecond): //target was cancelled before it started
+		}
+	}
+}
+
+func TestFuture_GetCtx_Deadline(t *testing.T) {
+	if future, err := RunAsync(func(ctx context.Context, delay time.Duration) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+			return true
+		}
+	}, 100*time.Millisecond); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else {
+		future.Execute()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		defer cancel()
+		if _, err := future.GetCtx(ctx); err != context.DeadlineExceeded {
+			t.Errorf("expected context.DeadlineExceeded but got %v", err)
+		}
+	}
+}
+
+func TestRunAsyncCtx_ParentCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if future, err := RunAsyncCtx(ctx, func() bool {
+		time.Sleep(100 * time.Millisecond)
+		return true
+	}); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else {
+		future.Execute()
+		cancel()
+		if _, err := future.Get(0); err != context.Canceled {
+			t.Errorf("expected context.Canceled but got %v", err)
+		}
+	}
+}
+
+func TestRunAsync_ContextPassed(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "passed")
+	if future, err := RunAsync(func(ctx context.Context) interface{} {
+		return ctx.Value(key{})
+	}, ctx); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else if get, err := future.Execute().Get(0); err != nil || get[0] != "passed" {
+		t.Errorf("expected the context passed to be used but got %v, %v", get, err)
+	}
+}
+
+func TestFuture_Get_Repeatable(t *testing.T) {
+	if future, err := RunAsync(func() int {
+		time.Sleep(10 * time.Millisecond)
+		return 2
+	}); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else {
+		future.Execute()
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if get, err := future.Get(0); err != nil || get[0] != 2 {
+					t.Errorf("expected 2 but got %v, %v", get, err)
+				}
+			}()
+		}
+		wg.Wait()
+		if get, err := future.Get(0); err != nil || get[0] != 2 {
+			t.Errorf("expected 2 but got %v, %v", get, err)
+		}
+	}
+}
+
+func TestFuture_Done(t *testing.T) {
+	if future, err := RunAsync(func() int {
+		return 2
+	}); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else {
+		if future.Result() != nil || future.Err() != nil {
+			t.Errorf("did not expect a result before the future is done")
+		}
+		future.Execute()
+		select {
+		case <-future.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("expected the future to be done")
+		}
+		if future.Err() != nil || future.Result()[0] != 2 || future.Stage() != COMPLETED {
+			t.Errorf("expected 2 but got %v, %v", future.Result(), future.Err())
+		}
+	}
+}
+
+func TestFuture_Err_Cancelled(t *testing.T) {
+	if future, err := RunAsync(func() int {
+		time.Sleep(50 * time.Millisecond)
+		return 2
+	}); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else {
+		future.Execute()
+		if !future.Cancel() {
+			t.Errorf("expected the future to be cancelled")
+		}
+		<-future.Done()
+		if future.Err() != ErrAborted || future.Stage() != ABORTED {
+			t.Errorf("expected ErrAborted but got %v", future.Err())
+		}
+		if future.Cancel() {
+			t.Errorf("did not expect a done future to be cancelled again")
+		}
+		if _, err := future.Get(0); err != ErrAborted {
+			t.Errorf("expected ErrAborted but got %v", err)
+		}
+	}
+}
+
+func TestFuture_Stage_NoCompletedAfterAborted(t *testing.T) {
+	returned := make(chan bool)
+	if future, err := RunAsync(func() int {
+		defer close(returned)
+		time.Sleep(20 * time.Millisecond)
+		return 2
+	}); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else {
+		future.Execute()
+		for future.Stage() != RUNNING {
+			time.Sleep(time.Millisecond)
+		}
+		future.Cancel()
+		<-returned
+		time.Sleep(5 * time.Millisecond)
+		if future.Stage() != ABORTED || future.Result() != nil || future.Err() != ErrAborted {
+			t.Errorf("expected the future to stay ABORTED but got %d, %v, %v", future.Stage(), future.Result(), future.Err())
+		}
+	}
+}
+
+func TestFuture_ConcurrentCancelAndGet(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		future, _ := RunAsync(func() int {
+			return 2
+		})
+		future.Execute()
+		var wg sync.WaitGroup
+		results := make(chan error, 2)
+		for g := 0; g < 2; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := future.Get(0)
+				results <- err
+			}()
+		}
+		go future.Cancel()
+		wg.Wait()
+		if err1, err2 := <-results, <-results; err1 != err2 {
+			t.Errorf("expected every Get() to see the same result but got %v and %v", err1, err2)
+		}
+	}
+}
+
+func TestFuture_OnComplete(t *testing.T) {
+	completed := make(chan []interface{}, 2)
+	failed := make(chan error, 1)
+	if future, err := RunAsync(func() int {
+		return 2
+	}); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else {
+		future.OnComplete(func(returned []interface{}) {
+			completed <- returned
+		}).OnError(func(err error) {
+			failed <- err
+		}).Execute()
+
+		if returned := <-completed; returned[0] != 2 {
+			t.Errorf("expected 2 but got %v", returned)
+		}
+		future.OnComplete(func(returned []interface{}) {
+			completed <- returned
+		})
+		if returned := <-completed; returned[0] != 2 {
+			t.Errorf("expected callback registered after completion to be called with 2 but got %v", returned)
+		}
+		select {
+		case err := <-failed:
+			t.Errorf("did not expect OnError to be called with %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestFuture_OnError(t *testing.T) {
+	es := NewExecutorService(1, 1)
+	defer es.Shutdown()
+	callbackES := NewExecutorService(1, 1)
+	defer callbackES.Shutdown()
+
+	failed := make(chan error, 1)
+	if future, err := RunAsync(func() int {
+		panic("boom")
+	}); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else {
+		future.SetExecutor(es).SetCallbackExecutor(callbackES).OnError(func(err error) {
+			failed <- err
+		}).Execute()
+
+		select {
+		case err := <-failed:
+			if _, ok := err.(*PanicError); !ok {
+				t.Errorf("expected a PanicError but got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("expected OnError to be called")
+		}
+	}
+
+	if future, err := RunAsync(func() int {
+		time.Sleep(50 * time.Millisecond)
+		return 2
+	}); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else {
+		future.OnError(func(err error) {
+			failed <- err
+		}).Execute().Get(5 * time.Millisecond)
+
+		if err := <-failed; err != ErrTimedOut {
+			t.Errorf("expected ErrTimedOut but got %v", err)
+		}
+	}
+}
+
+func TestFuture_OnCancel(t *testing.T) {
+	cancelled := make(chan bool, 1)
+	if future, err := RunAsync(func() int {
+		time.Sleep(50 * time.Millisecond)
+		return 2
+	}); err != nil {
+		t.Errorf("error (%s) creating future", err.Error())
+	} else {
+		future.OnCancel(func() {
+			cancelled <- true
+		}).OnComplete(func(returned []interface{}) {
+			cancelled <- false
+		}).Execute()
+		future.Cancel()
+
+		if !<-cancelled {
+			t.Errorf("expected OnCancel to be called")
+		}
+	}
+}
+
 func ExampleRunAsync() {
 	add := func(operands ...int) int {
 		time.Sleep(50 * time.Millisecond) //simulate a blocking call
@@ -110,11 +435,11 @@ func ExampleRunAsync() {
 	}
 
 	if future, err := RunAsync(add, 1, 2, 3, 4); err != nil {
-		fmt.Errorf("error (%s) creating a future for add func", err.Error())
+		fmt.Printf("error (%s) creating a future for add func\n", err.Error())
 	} else {
 		future.Execute()                                                //submit the future
 		if sum, err := future.Get(100 * time.Millisecond); err != nil { //timed waiting
-			fmt.Errorf("error (%s) while waiting for execution completion", err.Error())
+			fmt.Printf("error (%s) while waiting for execution completion\n", err.Error())
 		} else {
 			fmt.Println(sum[0])
 		}
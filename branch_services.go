@@ -0,0 +1,152 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// branch is run by a BRANCH step, the selector is called with the results of the previous step(s) and
+// the flow of the case matching the value returned is run.
+type branch struct {
+	selector  interface{} //predicate of ThenIf() or key function of ThenSwitch()
+	cases     map[interface{}]*Flow
+	otherwise *Flow
+	predicate bool //the selector returns a bool, possibly of a named type, thenFlow is the case of true
+}
+
+// This method creates a new step in the Flow that chooses the flow to run next at runtime.
+// The predicate is called with the results of the previous step, like a target function added by ThenApply(),
+// and has to return a bool. thenFlow is run if it returns true, elseFlow otherwise.
+// The results of the previous step are passed to the first step of the chosen flow after its own args,
+// the results of the chosen flow are passed on to the next step. A nil flow passes on the results of the previous step.
+// Every flow the step can choose has to pass on values of the same types, which is checked by Validate().
+// A copy of the chosen flow is run on the executor of this flow and is cancelled with it, so the same flow can be
+// chosen by any number of steps and runs.
+func (fl *Flow) ThenIf(predicate interface{}, thenFlow, elseFlow *Flow) *Flow {
+	return fl.addBranch(predicate, map[interface{}]*Flow{true: thenFlow}, elseFlow, true)
+}
+
+// This method creates a new step in the Flow that chooses the flow to run next at runtime, like ThenIf().
+// The key function is called with the results of the previous step and the flow of the case equal to the value it
+// returns is run, defaultFlow is run if no case matches. The keys of the cases have to be of the type the key function
+// returns, e.g. a key func returning a named string type does not match untyped string keys, unless it returns an interface.
+func (fl *Flow) ThenSwitch(key interface{}, cases map[interface{}]*Flow, defaultFlow *Flow) *Flow {
+	return fl.addBranch(key, cases, defaultFlow, false)
+}
+
+func (fl *Flow) addBranch(selector interface{}, cases map[interface{}]*Flow, otherwise *Flow, predicate bool) *Flow {
+	fl.steps = append(fl.steps, &step{
+		targetFunc: selector,
+		op:         BRANCH,
+		branch:     &branch{selector: selector, cases: cases, otherwise: otherwise, predicate: predicate},
+	})
+
+	selectorType := reflect.TypeOf(selector)
+	if selectorType == nil || selectorType.Kind() != reflect.Func {
+		fl.invalid(len(fl.steps)-1, fmt.Errorf("%T un-supported type", selector))
+	} else if selectorType.NumOut() != 1 {
+		fl.invalid(len(fl.steps)-1, fmt.Errorf("%s has to return a single value", selectorType))
+	} else if predicate && selectorType.Out(0).Kind() != reflect.Bool {
+		fl.invalid(len(fl.steps)-1, fmt.Errorf("predicate %s has to return a bool", selectorType))
+	} else if !predicate {
+		keyType := selectorType.Out(0)
+		for key := range cases {
+			if caseType := reflect.TypeOf(key); caseType == nil && keyType.Kind() != reflect.Interface ||
+				caseType != nil && !caseType.AssignableTo(keyType) {
+				fl.invalid(len(fl.steps)-1, fmt.Errorf("case %v of type %T does not match the key of type %s", key, key, keyType))
+				break
+			}
+		}
+	}
+	return fl
+}
+
+// validate checks the selector and every flow the branch can choose, with the arguments of argTypes.
+// Returns the types of the values the step passes on, which have to be the same whichever flow is chosen,
+// a nil flow passes on its arguments. unknown is true if they are known only at runtime.
+func (b *branch) validate(argTypes []reflect.Type, argsUnknown bool) ([]reflect.Type, bool, error) {
+	if !argsUnknown {
+		if err := validateArgs(reflect.TypeOf(b.selector), argTypes); err != nil {
+			return nil, false, err
+		}
+	}
+	var outputs []reflect.Type
+	known, unknown := false, false
+	choose := func(flow *Flow, name string) error {
+		flowOutputs, flowUnknown := argTypes, argsUnknown
+		if flow != nil {
+			var err error
+			if flowOutputs, flowUnknown, err = flow.resultTypes(argTypes, argsUnknown); err != nil {
+				return fmt.Errorf("%s is not valid: %w", name, err)
+			}
+		}
+		if flowUnknown {
+			unknown = true
+			return nil
+		}
+		if known && !sameTypes(outputs, flowOutputs) {
+			return fmt.Errorf("%s passes on %v, other flows of the step pass on %v", name, flowOutputs, outputs)
+		}
+		outputs, known = flowOutputs, true
+		return nil
+	}
+	for key, flow := range b.cases {
+		if err := choose(flow, fmt.Sprintf("flow of case %v", key)); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := choose(b.otherwise, "default flow"); err != nil {
+		return nil, false, err
+	}
+	if unknown {
+		return nil, true, nil
+	}
+	return outputs, false, nil
+}
+
+func sameTypes(a, b []reflect.Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// start calls the selector and runs the flow chosen with the inputs of the flow, done is called with the results of its
+// last step once the chosen flow is done. The chosen flow is not waited for, no worker is held while it runs.
+func (b *branch) start(ctx context.Context, es *ExecutorService, inputs Inputs, args []interface{}, done func([]interface{}, error)) {
+	selected, err := invoke(ctx, b.selector, args)
+	if err != nil {
+		done(nil, err)
+		return
+	}
+	key := selected[0]
+	if b.predicate {
+		key = reflect.ValueOf(key).Bool() //the case of thenFlow is the untyped true
+	}
+
+	chosen, found := b.cases[key]
+	if !found {
+		chosen = b.otherwise
+	}
+	if chosen == nil {
+		done(args, nil)
+		return
+	}
+	run := chosen.clone(ctx, stateOf(ctx)) //the chosen flow may be run by other steps and flows at the same time
+	run.es = es
+	run.input = args
+	runFtr, err := run.ExecuteWith(inputs).flowFuture()
+	if err != nil {
+		done(nil, err)
+		return
+	}
+	runFtr.whenDone(func() {
+		done(run.result(runFtr.funcReturned, runFtr.err))
+	})
+}
@@ -0,0 +1,220 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func pricingFlow(amount, threshold int) *Flow {
+	return NewFlow(func(amount int) int {
+		return amount
+	}, amount).ThenIf(func(amount int) bool {
+		return amount > threshold
+	}, NewFlow(func(amount int) int {
+		return amount * 90 / 100
+	}), NewFlow(func(amount int) (int, error) {
+		return amount + 5, nil
+	})).ThenApply(func(price int) string {
+		return fmt.Sprintf("price %d", price)
+	})
+}
+
+func TestFlow_ThenIf(t *testing.T) {
+	flow := pricingFlow(200, 100)
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != "price 180" {
+		t.Errorf("expected 'price 180' from the then flow but got %v, %v", get, err)
+	}
+
+	flow = pricingFlow(50, 100)
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != "price 55" {
+		t.Errorf("expected 'price 55' from the else flow but got %v, %v", get, err)
+	}
+}
+
+func TestFlow_ThenIf_NilFlowPassesResults(t *testing.T) {
+	flow := NewFlow(func() (int, string) {
+		return 1, "one"
+	}).ThenIf(func(n int, s string) bool {
+		return false
+	}, NewFlow(func(n int, s string) (int, string) {
+		return 2, "two"
+	}), nil).ThenApply(func(n int, s string) string {
+		return fmt.Sprintf("%d %s", n, s)
+	})
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != "1 one" {
+		t.Errorf("expected '1 one' but got %v, %v", get, err)
+	}
+}
+
+func TestFlow_ThenSwitch(t *testing.T) {
+	route := func(tier string) *Flow {
+		return NewFlow(func() string {
+			return tier
+		}).ThenSwitch(func(tier string) string {
+			return tier
+		}, map[interface{}]*Flow{
+			"gold":   NewFlow(func(string) int { return 30 }),
+			"silver": NewFlow(func(string) int { return 20 }),
+		}, NewFlow(func(string) int { return 0 }))
+	}
+
+	expected := map[string]int{"gold": 30, "silver": 20, "bronze": 0}
+	for tier, discount := range expected {
+		flow := route(tier)
+		flow.Execute()
+		if get, err := flow.Get(time.Second); err != nil || get[0] != discount {
+			t.Errorf("expected discount %d for %s but got %v, %v", discount, tier, get, err)
+		}
+	}
+}
+
+type approval bool
+
+type tier string
+
+func TestFlow_ThenIf_NamedBool(t *testing.T) {
+	flow := NewFlow(func() int {
+		return 1
+	}).ThenIf(func(int) approval {
+		return true
+	}, NewFlow(func(int) string { return "then" }), NewFlow(func(int) string { return "else" }))
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != "then" {
+		t.Errorf("expected the then flow to run but got %v, %v", get, err)
+	}
+
+	def, err := NewFlow(func() int {
+		return 1
+	}).ThenIf(func(int) approval {
+		return true
+	}, NewFlow(func(int) string { return "then" }), NewFlow(func(int) string { return "else" })).Define()
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if get, err := def.Run(context.Background()).Get(time.Second); err != nil || get[0] != "then" {
+		t.Errorf("expected the then flow to run for a definition but got %v, %v", get, err)
+	}
+}
+
+func TestFlow_ThenSwitch_KeyType(t *testing.T) {
+	named := NewFlow(func() tier {
+		return "gold"
+	}).ThenSwitch(func(t tier) tier {
+		return t
+	}, map[interface{}]*Flow{
+		tier("gold"): NewFlow(func(tier) int { return 30 }),
+	}, NewFlow(func(tier) int { return 0 }))
+	named.Execute()
+	if get, err := named.Get(time.Second); err != nil || get[0] != 30 {
+		t.Errorf("expected the case of the named key to run but got %v, %v", get, err)
+	}
+
+	mismatch := NewFlow(func() tier {
+		return "gold"
+	}).ThenSwitch(func(t tier) tier {
+		return t
+	}, map[interface{}]*Flow{
+		"gold": NewFlow(func(tier) int { return 30 }),
+	}, nil)
+	if err := mismatch.Validate(); err == nil {
+		t.Errorf("expected an error for a case not of the type of the key")
+	}
+}
+
+func TestFlow_ThenIf_BranchFails(t *testing.T) {
+	failed := errors.New("failed")
+	flow := NewFlow(func() int {
+		return 1
+	}).ThenIf(func(int) bool {
+		return true
+	}, NewFlow(func(int) (int, error) {
+		return 0, failed
+	}), nil)
+
+	flow.Execute()
+	_, err := flow.Get(time.Second)
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Op != BRANCH || !errors.Is(err, failed) {
+		t.Errorf("expected the BRANCH step to fail with %v but got %v", failed, err)
+	}
+}
+
+func TestFlow_ThenIf_Validate(t *testing.T) {
+	notBool := NewFlow(func() int { return 1 }).ThenIf(func(int) int { return 1 }, nil, nil)
+	if err := notBool.Validate(); err == nil {
+		t.Errorf("expected an error for a predicate not returning a bool")
+	}
+
+	mismatch := NewFlow(func() int { return 1 }).ThenIf(func(int) bool {
+		return true
+	}, NewFlow(func(string) int { return 1 }), nil)
+	var stepErr *StepError
+	if err := mismatch.Validate(); !errors.As(err, &stepErr) || stepErr.Index != 1 {
+		t.Errorf("expected the then flow not accepting an int to be reported but got %v", err)
+	}
+
+	disagree := NewFlow(func() int { return 1 }).ThenIf(func(int) bool {
+		return false
+	}, NewFlow(func(int) string { return "one" }), nil).ThenApply(func(s string) string {
+		return s
+	})
+	if err := disagree.Validate(); !errors.As(err, &stepErr) || stepErr.Index != 1 {
+		t.Errorf("expected the nil else flow passing on an int to be reported but got %v", err)
+	}
+
+	next := NewFlow(func() int { return 1 }).ThenIf(func(int) bool {
+		return true
+	}, NewFlow(func(int) string { return "one" }), NewFlow(func(int) string { return "two" })).ThenApply(func(n int) int {
+		return n
+	})
+	if err := next.Validate(); !errors.As(err, &stepErr) || stepErr.Index != 2 {
+		t.Errorf("expected the step after the branch not accepting a string to be reported but got %v", err)
+	}
+}
+
+func TestFlow_ThenIf_SingleWorker(t *testing.T) {
+	es := NewExecutorService(10, 1)
+	defer es.Shutdown()
+	flow := pricingFlow(200, 100).SetExecutor(es)
+	flow.Execute()
+	if get, err := flow.Get(2 * time.Second); err != nil || get[0] != "price 180" {
+		t.Errorf("expected 'price 180' on a single worker but got %v, %v", get, err)
+	}
+}
+
+func TestFlow_ThenIf_SameFlowChosenByManyRuns(t *testing.T) {
+	double := NewFlow(func(n int) int {
+		return n * 2
+	})
+	results := make(chan int, 20)
+	for i := 0; i < 20; i++ {
+		go func(n int) {
+			flow := NewFlow(func(n int) int {
+				return n
+			}, n).ThenIf(func(int) bool {
+				return true
+			}, double, nil)
+			flow.Execute()
+			get, err := flow.Get(2 * time.Second)
+			if err != nil {
+				t.Errorf("expected no error but got %v", err)
+				results <- -1
+				return
+			}
+			results <- get[0].(int) - n*2
+		}(i)
+	}
+	for i := 0; i < 20; i++ {
+		if diff := <-results; diff != 0 {
+			t.Errorf("expected every run to get the result of its own copy of the chosen flow")
+		}
+	}
+}
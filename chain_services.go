@@ -0,0 +1,151 @@
+package workflow
+
+import (
+	"fmt"
+	"reflect"
+)
+
+var futureType = reflect.TypeOf((*Future)(nil))
+
+// binder decides the arguments of a chained target function from the previous future, which is done.
+// If call is false the target function is not called, the chained future is settled with the outcome of prev.
+type binder func(prev *Future, targetType reflect.Type) (args []interface{}, call bool)
+
+// Then creates a future that calls the target function with the return values of this future, once it completes.
+// If this future fails the returned future fails with the same error, and is ABORTED if this future is ABORTED,
+// the target function is not called in either case.
+// The target function runs on the executor of this future, unless changed by SetExecutor() on the returned future.
+// Execute() on the returned future executes this future as well.
+func (f *Future) Then(targetFunc interface{}) *Future {
+	return f.chain(targetFunc, func(prev *Future, targetType reflect.Type) ([]interface{}, bool) {
+		if prev.err != nil {
+			return nil, false
+		}
+		return prev.funcReturned, true
+	})
+}
+
+// Same as Then(), the target function runs on the executor passed.
+func (f *Future) ThenAsync(executor *ExecutorService, targetFunc interface{}) *Future {
+	return f.Then(targetFunc).SetExecutor(executor)
+}
+
+// Compose is like Then(), except the target function returns a *Future as its first return value,
+// the returned future completes with the results of that future instead of the *Future itself.
+// The future returned by the target function is executed if it is not executed already.
+// A context.Context first parameter of the target function is passed the context of the returned future,
+// so the future created with it is aborted when the returned future is cancelled.
+func (f *Future) Compose(targetFunc interface{}) *Future {
+	next := newFuture(f.parentCtx)
+	next.es = f.es
+	targetType := reflect.TypeOf(targetFunc)
+	if targetType != nil && targetType.Kind() == reflect.Func && (targetType.NumOut() == 0 || targetType.Out(0) != futureType) {
+		next.settle(nil, fmt.Errorf("target function of Compose() has to return a *Future as its first value"))
+		return next
+	}
+
+	outer := f.chain(targetFunc, func(prev *Future, targetType reflect.Type) ([]interface{}, bool) {
+		if prev.err != nil {
+			return nil, false
+		}
+		if injectsContext(targetType, typesOf(prev.funcReturned)) {
+			return append([]interface{}{next.ctx}, prev.funcReturned...), true
+		}
+		return prev.funcReturned, true
+	})
+	next.deps = []*Future{outer}
+	next.trigger = func() {
+		outer.whenDone(func() {
+			if outer.err != nil {
+				next.adopt(outer)
+				return
+			}
+			inner, _ := outer.funcReturned[0].(*Future)
+			if inner == nil {
+				next.settle(nil, fmt.Errorf("target function of Compose() returned a nil *Future"))
+				return
+			}
+			next.OnCancel(func() {
+				inner.Cancel()
+			})
+			inner.Execute()
+			inner.whenDone(func() {
+				next.adopt(inner)
+			})
+		})
+	}
+	next.OnCancel(func() {
+		outer.Cancel()
+	})
+	return next
+}
+
+// Handle creates a future that calls the target function once this future is done, whether it completed or failed.
+// The target function receives the return values of this future followed by the error of this future,
+// its last parameter has to be an error. If this future failed, zero values are passed for the return values.
+// The returned future completes with the return values of the target function.
+func (f *Future) Handle(targetFunc interface{}) *Future {
+	return f.chain(targetFunc, func(prev *Future, targetType reflect.Type) ([]interface{}, bool) {
+		if prev.err == nil {
+			args := make([]interface{}, 0, len(prev.funcReturned)+1)
+			return append(append(args, prev.funcReturned...), nil), true
+		}
+		first := 0
+		if targetType.NumIn() > 0 && targetType.In(0) == contextType {
+			first = 1
+		}
+		args := make([]interface{}, 0, targetType.NumIn())
+		for i := first; i < targetType.NumIn()-1; i++ {
+			args = append(args, reflect.Zero(targetType.In(i)).Interface())
+		}
+		return append(args, prev.err), true
+	})
+}
+
+// Exceptionally creates a future that calls the target function with the error of this future if it fails,
+// the return values of the target function replace the results. If this future completes, the returned
+// future completes with the same results and the target function is not called.
+func (f *Future) Exceptionally(targetFunc interface{}) *Future {
+	return f.chain(targetFunc, func(prev *Future, targetType reflect.Type) ([]interface{}, bool) {
+		if prev.err == nil {
+			return nil, false
+		}
+		return []interface{}{prev.err}, true
+	})
+}
+
+// chain creates a future that depends on this one, once this future is done the arguments are bound by bind
+// and the target function is submitted.
+func (f *Future) chain(targetFunc interface{}, bind binder) *Future {
+	next := newFuture(f.parentCtx)
+	next.es = f.es
+	next.deps = []*Future{f}
+
+	if kind := reflect.ValueOf(targetFunc).Kind(); kind != reflect.Func {
+		next.settle(nil, fmt.Errorf("%s un-supported type", kind))
+		return next
+	}
+	targetType := reflect.TypeOf(targetFunc)
+	next.targetFunc = targetFunc
+	next.voidReturn = targetType.NumOut() == 0
+	next.trigger = func() {
+		f.whenDone(func() {
+			args, call := bind(f, targetType)
+			if !call {
+				next.adopt(f)
+				return
+			}
+			argTypes := typesOf(args)
+			if err := validateArgs(targetType, argTypes); err != nil {
+				next.settle(nil, err)
+				return
+			}
+			next.paramsPassed = args
+			next.injectCtx = injectsContext(targetType, argTypes)
+			next.injectState = injectsState(targetType, argTypes)
+			next.detached = true
+			next.submit()
+		})
+	}
+	return next
+}
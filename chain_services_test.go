@@ -0,0 +1,197 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFuture_Then(t *testing.T) {
+	future, _ := RunAsync(func(a, b int) (int, string) {
+		return a + b, "sum"
+	}, 1, 2)
+
+	chained := future.Then(func(sum int, label string) string {
+		return fmt.Sprintf("%s=%d", label, sum)
+	}).Then(strings.ToUpper).Execute()
+
+	if get, err := chained.Get(time.Second); err != nil {
+		t.Errorf("expected no error but got %v", err)
+	} else if get[0] != "SUM=3" {
+		t.Errorf("expected SUM=3 but got %v", get[0])
+	}
+	if future.Stage() != COMPLETED {
+		t.Errorf("expected the first future to be executed and COMPLETED but it is %d", future.Stage())
+	}
+}
+
+func TestFuture_Then_FailurePropagates(t *testing.T) {
+	called := int32(0)
+	future, _ := RunAsync(func() int {
+		panic("boom")
+	})
+
+	chained := future.Then(func(int) int {
+		atomic.StoreInt32(&called, 1)
+		return 0
+	}).Execute()
+
+	_, err := chained.Get(time.Second)
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Errorf("expected the PanicError of the first future but got %v", err)
+	}
+	if atomic.LoadInt32(&called) == 1 {
+		t.Errorf("target function is not expected to be called when the previous future fails")
+	}
+}
+
+func TestFuture_Then_Cancelled(t *testing.T) {
+	future, _ := RunAsync(func() int {
+		time.Sleep(100 * time.Millisecond)
+		return 1
+	})
+	chained := future.Then(func(int) int {
+		return 2
+	}).Execute()
+	future.Cancel()
+
+	if _, err := chained.Get(time.Second); err != ErrAborted {
+		t.Errorf("expected %v but got %v", ErrAborted, err)
+	}
+	if chained.Stage() != ABORTED {
+		t.Errorf("expected stage ABORTED but got %d", chained.Stage())
+	}
+}
+
+func TestFuture_Then_InvalidTarget(t *testing.T) {
+	future, _ := RunAsync(func() int {
+		return 1
+	})
+
+	if _, err := future.Then(10).Execute().Get(time.Second); err == nil {
+		t.Errorf("expected an error for a target that is not a function")
+	}
+	if _, err := future.Then(func(string) {}).Execute().Get(time.Second); err == nil {
+		t.Errorf("expected an error for mismatching arguments")
+	}
+}
+
+func TestFuture_ThenAsync(t *testing.T) {
+	es := NewExecutorService(10, 1)
+	defer es.Shutdown()
+	ran := int32(0)
+
+	future, _ := RunAsync(func() int {
+		return 2
+	})
+	chained := future.ThenAsync(es, func(n int) int {
+		atomic.AddInt32(&ran, 1)
+		return n * n
+	}).Execute()
+
+	if get, err := chained.Get(time.Second); err != nil || get[0] != 4 {
+		t.Errorf("expected 4 but got %v, %v", get, err)
+	}
+	es.Shutdown()
+	es.AwaitTermination(time.Second)
+	if atomic.LoadInt32(&ran) != 1 {
+		t.Errorf("expected the target to run on the executor passed")
+	}
+}
+
+func TestFuture_Compose(t *testing.T) {
+	future, _ := RunAsync(func() int {
+		return 5
+	})
+
+	composed := future.Compose(func(ctx context.Context, n int) *Future {
+		inner, _ := RunAsyncCtx(ctx, func() int {
+			return n * 10
+		})
+		return inner
+	}).Execute()
+
+	if get, err := composed.Get(time.Second); err != nil {
+		t.Errorf("expected no error but got %v", err)
+	} else if get[0] != 50 {
+		t.Errorf("expected 50 but got %v", get[0])
+	}
+}
+
+func TestFuture_Compose_NotAFuture(t *testing.T) {
+	future, _ := RunAsync(func() int {
+		return 5
+	})
+
+	if _, err := future.Compose(func(n int) int { return n }).Execute().Get(time.Second); err == nil {
+		t.Errorf("expected an error when the target function does not return a *Future")
+	}
+	if _, err := future.Compose(func(n int) *Future { return nil }).Execute().Get(time.Second); err == nil {
+		t.Errorf("expected an error when the target function returns a nil *Future")
+	}
+}
+
+func TestFuture_Handle(t *testing.T) {
+	handler := func(n int, err error) string {
+		if err != nil {
+			return "failed: " + err.Error()
+		}
+		return fmt.Sprintf("got %d", n)
+	}
+
+	ok, _ := RunAsync(func() int {
+		return 7
+	})
+	if get, err := ok.Handle(handler).Execute().Get(time.Second); err != nil || get[0] != "got 7" {
+		t.Errorf("expected 'got 7' but got %v, %v", get, err)
+	}
+
+	failed, _ := RunAsync(func() int {
+		panic("boom")
+	})
+	if get, err := failed.Handle(handler).Execute().Get(time.Second); err != nil || get[0] != "failed: panic: boom" {
+		t.Errorf("expected 'failed: panic: boom' but got %v, %v", get, err)
+	}
+}
+
+func TestFuture_Exceptionally(t *testing.T) {
+	fallback := func(err error) int {
+		return -1
+	}
+
+	failed, _ := RunAsync(func() int {
+		panic("boom")
+	})
+	if get, err := failed.Exceptionally(fallback).Execute().Get(time.Second); err != nil || get[0] != -1 {
+		t.Errorf("expected the fallback -1 but got %v, %v", get, err)
+	}
+
+	ok, _ := RunAsync(func() int {
+		return 3
+	})
+	if get, err := ok.Exceptionally(fallback).Execute().Get(time.Second); err != nil || get[0] != 3 {
+		t.Errorf("expected 3 to pass through but got %v, %v", get, err)
+	}
+}
+
+func ExampleFuture_Then() {
+	future, _ := RunAsync(func(name string) string {
+		return "hello " + name
+	}, "gopher")
+
+	greeting, _ := future.Then(strings.ToUpper).
+		Exceptionally(func(err error) string {
+			return "no greeting"
+		}).
+		Execute().
+		Get(time.Second)
+	fmt.Println(greeting[0])
+
+	//// Output:
+	//// HELLO GOPHER
+}
@@ -0,0 +1,145 @@
+package workflow
+
+import (
+	"strings"
+)
+
+// AggregateError is the failure of a group of futures, it holds the error of every member that failed.
+type AggregateError struct {
+	Errors []error
+}
+
+func (a *AggregateError) Error() string {
+	msgs := make([]string, 0, len(a.Errors))
+	for _, err := range a.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return "failed with [" + strings.Join(msgs, "; ") + "]"
+}
+
+func (a *AggregateError) Unwrap() []error {
+	return a.Errors
+}
+
+// AllOf creates a future that completes when all the futures are done, its results are the results of each future
+// in order, i.e. Get() returns one []interface{} per future. If any of the futures fail, the returned future fails with
+// an AggregateError of every failure once all of them are done. It completes right away if no futures are passed.
+// Execute() on the returned future triggers the execution of the futures, cancelling it cancels the futures.
+func AllOf(futures ...*Future) *Future {
+	combined := newCombined(futures)
+	results := make([]interface{}, len(futures))
+	var failures []error
+	pending := len(futures)
+	if pending == 0 {
+		combined.Complete()
+	}
+	watch(combined, futures, func(i int) bool {
+		if err := futures[i].Err(); err != nil {
+			failures = append(failures, err)
+		}
+		results[i] = futures[i].Result()
+		pending--
+		if pending > 0 {
+			return false
+		}
+		if failures != nil {
+			combined.Fail(&AggregateError{Errors: failures})
+		} else {
+			combined.Complete(results...)
+		}
+		return true
+	})
+	return combined.Future()
+}
+
+// AnyOf creates a future that completes with the results, or fails with the error, of the first future to be done.
+// The rest of the futures are cancelled. It fails right away with an empty AggregateError if no futures are passed.
+// Execute() on the returned future triggers the execution of the futures, cancelling it cancels the futures.
+func AnyOf(futures ...*Future) *Future {
+	combined := newCombined(futures)
+	if len(futures) == 0 {
+		combined.Fail(&AggregateError{})
+	}
+	watch(combined, futures, func(i int) bool {
+		if err := futures[i].Err(); err != nil {
+			combined.Fail(err)
+		} else {
+			combined.Complete(futures[i].Result()...)
+		}
+		cancelAll(futures)
+		return true
+	})
+	return combined.Future()
+}
+
+// FirstSuccessful creates a future that completes with the results of the first future to complete successfully,
+// the rest of the futures are cancelled. If none of the futures complete successfully the returned future fails with
+// an AggregateError of every failure, which is empty if no futures are passed.
+// Execute() on the returned future triggers the execution of the futures, cancelling it cancels the futures.
+func FirstSuccessful(futures ...*Future) *Future {
+	combined := newCombined(futures)
+	var failures []error
+	pending := len(futures)
+	if pending == 0 {
+		combined.Fail(&AggregateError{})
+	}
+	watch(combined, futures, func(i int) bool {
+		pending--
+		if err := futures[i].Err(); err != nil {
+			failures = append(failures, err)
+			if pending > 0 {
+				return false
+			}
+			combined.Fail(&AggregateError{Errors: failures})
+			return true
+		}
+		combined.Complete(futures[i].Result()...)
+		cancelAll(futures)
+		return true
+	})
+	return combined.Future()
+}
+
+// newCombined creates the promise completed by a combinator, it runs on the executor of the futures.
+func newCombined(futures []*Future) *Promise {
+	combined := NewPromise()
+	combined.future.deps = futures
+	if len(futures) > 0 {
+		combined.future.es = futures[0].es
+	}
+	return combined
+}
+
+// watch calls onDone with the index of each future as it is done, until onDone returns true.
+// The futures are cancelled if the combined future is done first, i.e. cancelled or timed out.
+func watch(combined *Promise, futures []*Future, onDone func(i int) bool) {
+	doneC := make(chan int, len(futures))
+	for i := range futures {
+		go func(i int) {
+			select {
+			case <-futures[i].Done():
+				doneC <- i
+			case <-combined.future.Done():
+			}
+		}(i)
+	}
+	go func() {
+		for range futures {
+			select {
+			case i := <-doneC:
+				if onDone(i) {
+					return
+				}
+			case <-combined.future.Done():
+				cancelAll(futures)
+				return
+			}
+		}
+	}()
+}
+
+func cancelAll(futures []*Future) {
+	for _, f := range futures {
+		f.Cancel()
+	}
+}
@@ -0,0 +1,122 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAllOf(t *testing.T) {
+	first, _ := RunAsync(func() int {
+		time.Sleep(10 * time.Millisecond)
+		return 1
+	})
+	second, _ := RunAsync(func() (string, bool) {
+		return "two", true
+	})
+
+	if get, err := AllOf(first, second).Execute().Get(time.Second); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	} else if len(get) != 2 || get[0].([]interface{})[0] != 1 || get[1].([]interface{})[0] != "two" {
+		t.Errorf("expected results of both futures in order but got %v", get)
+	}
+}
+
+func TestAllOf_AggregatesErrors(t *testing.T) {
+	failed1, failed2 := errors.New("failed1"), errors.New("failed2")
+	first, second, third := NewPromise(), NewPromise(), NewPromise()
+	first.Fail(failed1)
+	second.Complete(2)
+	time.AfterFunc(10*time.Millisecond, func() {
+		third.Fail(failed2)
+	})
+
+	_, err := AllOf(first.Future(), second.Future(), third.Future()).Execute().Get(time.Second)
+	var aggregateErr *AggregateError
+	if !errors.As(err, &aggregateErr) || len(aggregateErr.Errors) != 2 {
+		t.Fatalf("expected an AggregateError of 2 errors but got %v", err)
+	}
+	if !errors.Is(err, failed1) || !errors.Is(err, failed2) {
+		t.Errorf("expected both the failures to be aggregated but got %v", err)
+	}
+}
+
+func TestAnyOf(t *testing.T) {
+	slow, _ := RunAsync(func() int {
+		time.Sleep(100 * time.Millisecond)
+		return 1
+	})
+	fast, _ := RunAsync(func() int {
+		return 2
+	})
+
+	if get, err := AnyOf(slow, fast).Execute().Get(time.Second); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	} else if get[0] != 2 {
+		t.Errorf("expected the result of the fast future but got %v", get)
+	}
+	<-slow.Done()
+	if slow.Stage() != ABORTED {
+		t.Errorf("expected the slow future to be cancelled but got %d", slow.Stage())
+	}
+}
+
+func TestFirstSuccessful(t *testing.T) {
+	failed := errors.New("failed")
+	failing, succeeding, pending := NewPromise(), NewPromise(), NewPromise()
+	failing.Fail(failed)
+	time.AfterFunc(10*time.Millisecond, func() {
+		succeeding.Complete(2)
+	})
+
+	if get, err := FirstSuccessful(failing.Future(), succeeding.Future(), pending.Future()).Execute().Get(time.Second); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	} else if get[0] != 2 {
+		t.Errorf("expected the result of the successful future but got %v", get)
+	}
+	<-pending.Future().Done()
+	if pending.Future().Stage() != ABORTED {
+		t.Errorf("expected the pending future to be cancelled but got %d", pending.Future().Stage())
+	}
+}
+
+func TestFirstSuccessful_AllFailed(t *testing.T) {
+	first, second := NewPromise(), NewPromise()
+	first.Fail(errors.New("failed1"))
+	second.Fail(errors.New("failed2"))
+
+	_, err := FirstSuccessful(first.Future(), second.Future()).Get(time.Second)
+	var aggregateErr *AggregateError
+	if !errors.As(err, &aggregateErr) || len(aggregateErr.Errors) != 2 {
+		t.Errorf("expected an AggregateError of 2 errors but got %v", err)
+	}
+}
+
+func TestAllOf_Cancel(t *testing.T) {
+	first, second := NewPromise(), NewPromise()
+	combined := AllOf(first.Future(), second.Future())
+
+	combined.Cancel()
+	<-first.Future().Done()
+	<-second.Future().Done()
+	if first.Future().Stage() != ABORTED || second.Future().Stage() != ABORTED {
+		t.Errorf("expected the futures to be cancelled along with the combined future")
+	}
+}
+
+func ExampleAllOf() {
+	getBillAmount, _ := RunAsync(func() int {
+		return 100
+	})
+	getDollarValue, _ := RunAsync(func() int {
+		return 60
+	})
+
+	if all, e := AllOf(getBillAmount, getDollarValue).Execute().Get(time.Second); e == nil {
+		fmt.Println(all[0].([]interface{})[0].(int) * all[1].([]interface{})[0].(int))
+	}
+
+	//// Output:
+	//// 6000
+}
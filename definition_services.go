@@ -0,0 +1,131 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FlowDefinition is a flow built once, e.g. at startup, that can be run any number of times, concurrently,
+// with different args. Every run gets its own copy of the steps, no state is shared between runs.
+type FlowDefinition struct {
+	flow    *Flow
+	indexed bool //the args of a run are the inputs of the Input(i) placeholders, see RunWith()
+}
+
+// FlowRun is a single run of a FlowDefinition.
+type FlowRun struct {
+	flow *Flow
+}
+
+// Define creates a FlowDefinition of the flow, the flow itself is not executed and changes made to it afterwards
+// do not change the definition. The runs use the executor of the flow, see SetExecutor().
+// Returns an error if the flow is not valid, the args passed to Run() are validated by every run.
+// A flow waiting for a future, see AndAwait(), can not be defined as the future completes only once.
+func (fl *Flow) Define() (*FlowDefinition, error) {
+	if err := fl.validate(nil, true); err != nil {
+		return nil, err
+	}
+	for i, s := range fl.steps {
+		if s.awaited != nil {
+			return nil, fl.stepError(i, fmt.Errorf("a step waiting for a future can not be run more than once"))
+		}
+	}
+	snapshot := fl.snapshot()
+	return &FlowDefinition{flow: snapshot, indexed: snapshot.indexed()}, nil
+}
+
+// Run starts a new run of the flow, args are passed to the first step after the args given to NewFlow().
+// The run is cancelled when the ctx is done. Get() of the run returns the error if args are not valid.
+// No worker of the executor is held while a run waits for its steps, so any number of runs can be in flight.
+func (def *FlowDefinition) Run(ctx context.Context, args ...interface{}) *FlowRun {
+	return def.RunWith(ctx, nil, args...)
+}
+
+// RunWith is same as Run(), the placeholders passed to the steps, see Input(), are resolved from the inputs of the run.
+// If a step is passed an Input(i) placeholder, the args are not passed to the first step, the i'th arg is the input
+// of the index i instead, e.g. Run(ctx, 42) resolves Input(0) to 42.
+func (def *FlowDefinition) RunWith(ctx context.Context, inputs Inputs, args ...interface{}) *FlowRun {
+	run := def.flow.clone(ctx, nil)
+	if def.indexed {
+		inputs = withArgs(inputs, args)
+	} else {
+		run.input = args
+	}
+	run.ExecuteWith(inputs)
+	return &FlowRun{flow: run}
+}
+
+// Get is same as *Flow.Get() for the run.
+func (r *FlowRun) Get(timeout time.Duration) ([]interface{}, error) {
+	return r.flow.Get(timeout)
+}
+
+// GetCtx is same as *Flow.GetCtx() for the run.
+func (r *FlowRun) GetCtx(ctx context.Context) ([]interface{}, error) {
+	return r.flow.GetCtx(ctx)
+}
+
+// Cancel is same as *Flow.Cancel() for the run, other runs of the definition are not affected.
+func (r *FlowRun) Cancel() {
+	r.flow.Cancel()
+}
+
+// CompensationErr is same as *Flow.CompensationErr() for the run.
+func (r *FlowRun) CompensationErr(timeout time.Duration) error {
+	return r.flow.CompensationErr(timeout)
+}
+
+// clone returns a flow with the steps of fl under the ctx, without the state of any run of fl.
+// The steps of the flow share the state passed, a new one if it is nil.
+func (fl *Flow) clone(ctx context.Context, state *FlowState) *Flow {
+	run := &Flow{
+		es:      fl.es,
+		err:     fl.err,
+		budget:  fl.budget,
+		input:   fl.input,
+		onError: fl.onError,
+		finally: fl.finally,
+	}
+	run.initCtx(ctx, state)
+	run.steps = make([]*step, len(fl.steps))
+	for i, s := range fl.steps {
+		c := *s
+		c.future, c.ctx, c.attempts, c.collector, c.foldErr, c.recovered, c.outcome = nil, nil, 0, nil, nil, nil, outcome{}
+		run.steps[i] = &c
+	}
+	return run
+}
+
+// snapshot returns a copy of the flow that is not changed by the builder methods called on fl afterwards, e.g.
+// ThenReduce() sets the fold of a MAP step and the cases of ThenSwitch() are a map of the caller.
+// The flows chosen by BRANCH steps are copied as well.
+func (fl *Flow) snapshot() *Flow {
+	if fl == nil {
+		return nil
+	}
+	snap := fl.clone(context.Background(), nil)
+	for _, s := range snap.steps {
+		if s.fold != nil {
+			fold := *s.fold
+			s.fold = &fold
+		}
+		if s.fanOut != nil {
+			fanOut := *s.fanOut
+			if fanOut.fold != nil {
+				fold := *fanOut.fold
+				fanOut.fold = &fold
+			}
+			s.fanOut = &fanOut
+		}
+		if s.branch != nil {
+			b := &branch{selector: s.branch.selector, cases: make(map[interface{}]*Flow, len(s.branch.cases)), predicate: s.branch.predicate}
+			for key, flow := range s.branch.cases {
+				b.cases[key] = flow.snapshot()
+			}
+			b.otherwise = s.branch.otherwise.snapshot()
+			s.branch = b
+		}
+	}
+	return snap
+}
@@ -0,0 +1,166 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFlowDefinition_Run(t *testing.T) {
+	es := NewExecutorService(100, 4)
+	defer es.Shutdown()
+	def, err := NewFlow(func(greeting string, name string) string {
+		return greeting + " " + name
+	}, "hello").ThenApply(func(s string) (int, string) {
+		return len(s), s
+	}).SetExecutor(es).Define()
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			get, err := def.Run(context.Background(), name).Get(time.Second)
+			if err != nil || get[1] != "hello "+name || get[0] != len("hello "+name) {
+				t.Errorf("expected the results of %s but got %v, %v", name, get, err)
+			}
+		}(fmt.Sprintf("user%d", i))
+	}
+	wg.Wait()
+}
+
+func TestFlowDefinition_Run_MoreRunsThanWorkers(t *testing.T) {
+	def, err := NewFlow(func(n int) int {
+		return n * 2
+	}).ThenApply(func(n int) int {
+		return n + 1
+	}).ThenApply(func(n int) int {
+		return n * 10
+	}).Define()
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			get, err := def.Run(context.Background(), n).Get(3 * time.Second)
+			if err != nil || get[0] != (n*2+1)*10 {
+				t.Errorf("expected %d but got %v, %v", (n*2+1)*10, get, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestFlowDefinition_Run_Cancel(t *testing.T) {
+	def, err := NewFlow(func(ctx context.Context, delay time.Duration) int {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+		return 1
+	}).Define()
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := def.Run(ctx, 10*time.Second)
+	other := def.Run(context.Background(), 20*time.Millisecond)
+	cancel()
+	if _, err := cancelled.Get(time.Second); err == nil {
+		t.Errorf("expected the run to be aborted when its ctx is done")
+	}
+	if get, err := other.Get(time.Second); err != nil || get[0] != 1 {
+		t.Errorf("expected the other run to complete but got %v, %v", get, err)
+	}
+}
+
+func TestFlowDefinition_Run_Branch(t *testing.T) {
+	def, err := NewFlow(func(amount int) int {
+		return amount
+	}).ThenIf(func(amount int) bool {
+		return amount > 100
+	}, NewFlow(func(amount int) int {
+		return amount * 90 / 100
+	}), nil).Define()
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	runs := map[int]int{200: 180, 50: 50, 1000: 900}
+	started := map[int]*FlowRun{}
+	for amount := range runs {
+		started[amount] = def.Run(context.Background(), amount)
+	}
+	for amount, run := range started {
+		if get, err := run.Get(time.Second); err != nil || get[0] != runs[amount] {
+			t.Errorf("expected %d for %d but got %v, %v", runs[amount], amount, get, err)
+		}
+	}
+}
+
+func TestFlowDefinition_Run_InvalidArgs(t *testing.T) {
+	def, err := NewFlow(func(n int) int { return n }).Define()
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	var stepErr *StepError
+	if _, err := def.Run(context.Background(), "1").Get(time.Second); !errors.As(err, &stepErr) {
+		t.Errorf("expected the args of the run to be invalid but got %v", err)
+	}
+}
+
+func TestFlow_Define_Invalid(t *testing.T) {
+	if _, err := NewFlow(func() int { return 1 }).ThenApply(func(string) {}).Define(); err == nil {
+		t.Errorf("expected an error for a flow that is not valid")
+	}
+
+	promise := NewPromise()
+	if _, err := NewFlowFromFuture(promise.Future()).Define(); err == nil {
+		t.Errorf("expected an error for a flow waiting for a future")
+	}
+}
+
+func TestFlow_Define_NotChangedAfterwards(t *testing.T) {
+	fl := NewFlow(func() []int {
+		return []int{1, 2, 3}
+	}).ThenMap(func(n int) int {
+		return n * 2
+	}, 0)
+	def, err := fl.Define()
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	fl.ThenReduce(0, func(sum, n int) int {
+		return sum + n
+	})
+	if get, err := def.Run(context.Background()).Get(time.Second); err != nil || !reflect.DeepEqual(get[0], []int{2, 4, 6}) {
+		t.Errorf("expected [2 4 6] from the definition but got %v, %v", get, err)
+	}
+
+	cases := map[interface{}]*Flow{"gold": NewFlow(func(string) int { return 30 })}
+	routed := NewFlow(func(tier string) string {
+		return tier
+	}).ThenSwitch(func(tier string) string {
+		return tier
+	}, cases, NewFlow(func(string) int { return 0 }))
+	def, err = routed.Define()
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	cases["gold"] = NewFlow(func(string) int { return 50 })
+	if get, err := def.Run(context.Background(), "gold").Get(time.Second); err != nil || get[0] != 30 {
+		t.Errorf("expected 30 from the definition but got %v, %v", get, err)
+	}
+}
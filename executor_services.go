@@ -1,16 +1,78 @@
 package workflow
 
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 const (
 	TASK_QUEUE_MAX   = 100
 	CONCURRENT_TASKS = 50
 )
 
-type task func()
+// RejectionPolicy decides what happens to a task that cannot be queued because the queue is full.
+type RejectionPolicy int
+
+const (
+	BLOCK_POLICY          RejectionPolicy = iota //the caller waits for space in the queue, used by Future and Flow unless changed
+	ABORT_POLICY                                 //the task is rejected with ErrQueueFull
+	CALLER_RUNS_POLICY                           //the task is run by the goroutine submitting it
+	DISCARD_OLDEST_POLICY                        //the oldest queued task is rejected to make space for the task, see SetDiscardHandler()
+	DISCARD_NEWEST_POLICY                        //the task is dropped, the caller is returned ErrQueueFull
+)
+
+var (
+	// ErrExecutorShutdown is returned when a task is submitted to, or discarded by, an ExecutorService that is shutdown.
+	ErrExecutorShutdown = errors.New("executor service is shutdown")
+	// ErrQueueFull is returned when a task is rejected because the queue of the ExecutorService is full.
+	ErrQueueFull = errors.New("executor service queue is full")
+)
+
+// Task is a function run by the workers of an ExecutorService.
+type Task func()
+
+// PanicError is the error reported when a task or a target function panics, Stack is the stack trace of the panic.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func newPanicError(recovered interface{}) *PanicError {
+	return &PanicError{Value: recovered, Stack: debug.Stack()}
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", p.Value)
+}
+
+// job is the unit queued on the ExecutorService, reject (if set) is called when the task is never going to be run.
+type job struct {
+	run    Task
+	reject func(error)
+}
 
 type ExecutorService struct {
-	tasksQueue         chan task
+	tasksQueue         chan *job
 	maxQueueSize       int
 	maxConcurrentTasks int
+	rejectionPolicy    RejectionPolicy
+	panicHandler       func(*PanicError)
+	discardHandler     func(Task)
+	mu                 sync.RWMutex //guards the rejection policy and the handlers
+	queueMu            sync.RWMutex //held for reading while a job is sent to the queue, for writing to close the queue
+	shutdown           bool         //guarded by queueMu
+	discard            int32
+	stopping           chan struct{} //closed when shutdown starts, releases blocked submitters
+	terminated         chan struct{} //closed when all the workers have exited
+	shutdownOnce       sync.Once
+	workers            sync.WaitGroup
+	pulling            sync.RWMutex //held for reading by a worker from taking a job until it is either dropped or run
+	droppedMu          sync.Mutex
+	dropped            []Task
 }
 
 var (
@@ -21,29 +83,330 @@ func init() {
 	default_es = NewExecutorService(TASK_QUEUE_MAX, CONCURRENT_TASKS)
 }
 
-func (t task) execute() {
+func (t Task) execute() {
 	t()
 }
 
 func NewExecutorService(queueSize, parallelTasks int) *ExecutorService {
 	newService := &ExecutorService{
-		tasksQueue:         make(chan task, queueSize),
+		tasksQueue:         make(chan *job, queueSize),
 		maxQueueSize:       queueSize,
 		maxConcurrentTasks: parallelTasks,
+		stopping:           make(chan struct{}),
+		terminated:         make(chan struct{}),
 	}
 	newService.runJobs()
 	return newService
 }
 
-func (e *ExecutorService) Submit(task task) {
-	e.tasksQueue <- task
+// Submit queues the task for execution, the call blocks while the queue is full.
+// ErrExecutorShutdown is returned if the service is shutdown before the task could be queued.
+func (e *ExecutorService) Submit(task Task) error {
+	return e.submit(&job{run: task})
+}
+
+// TrySubmit queues the task without blocking, if the queue is full the rejection policy is applied.
+// BLOCK_POLICY is treated as ABORT_POLICY by this method.
+func (e *ExecutorService) TrySubmit(task Task) error {
+	return e.offer(&job{run: task}, 0)
+}
+
+// SubmitWithTimeout waits up to the timeout for space in the queue, after which the rejection policy is applied.
+// BLOCK_POLICY is treated as ABORT_POLICY by this method.
+func (e *ExecutorService) SubmitWithTimeout(task Task, timeout time.Duration) error {
+	return e.offer(&job{run: task}, timeout)
+}
+
+// SetRejectionPolicy changes how the Future(s), Flow(s) and TrySubmit() calls using this service handle a full queue.
+func (e *ExecutorService) SetRejectionPolicy(policy RejectionPolicy) *ExecutorService {
+	e.mu.Lock()
+	e.rejectionPolicy = policy
+	e.mu.Unlock()
+	return e
+}
+
+// SetPanicHandler registers a hook that is called, on the worker, with every panic recovered from a task or a target function.
+func (e *ExecutorService) SetPanicHandler(handler func(*PanicError)) *ExecutorService {
+	e.mu.Lock()
+	e.panicHandler = handler
+	e.mu.Unlock()
+	return e
+}
+
+// SetDiscardHandler registers a hook that is called with every task dropped by DISCARD_OLDEST_POLICY that was queued
+// by Submit(), TrySubmit() or SubmitWithTimeout(), as its caller was returned nil already. The future of a dropped
+// target function is REJECTED with ErrQueueFull instead.
+func (e *ExecutorService) SetDiscardHandler(handler func(Task)) *ExecutorService {
+	e.mu.Lock()
+	e.discardHandler = handler
+	e.mu.Unlock()
+	return e
+}
+
+func (e *ExecutorService) handleDiscard(task Task) {
+	e.mu.RLock()
+	handler := e.discardHandler
+	e.mu.RUnlock()
+	if handler != nil {
+		handler(task)
+	}
+}
+
+func (e *ExecutorService) handlePanic(p *PanicError) {
+	e.mu.RLock()
+	handler := e.panicHandler
+	e.mu.RUnlock()
+	if handler != nil {
+		handler(p)
+	}
+}
+
+// run executes the job recovering from any panic, so the worker goroutine survives it.
+func (e *ExecutorService) run(j *job) {
+	defer func() {
+		if r := recover(); r != nil {
+			e.handlePanic(newPanicError(r))
+		}
+	}()
+	j.run.execute()
+}
+
+// submitCallback queues the callback of a Future without blocking, as it is submitted by the worker completing the future.
+// A callback that can not be queued is run on a new goroutine instead of being dropped.
+func (e *ExecutorService) submitCallback(callback Task) {
+	j := &job{run: callback}
+	j.reject = func(error) {
+		go e.run(j)
+	}
+	if err := e.offer(j, 0); err == ErrExecutorShutdown {
+		j.reject(err)
+	}
+}
+
+// dispatch is used by Future(s) to queue their target, it honours the rejection policy of the service.
+func (e *ExecutorService) dispatch(j *job) error {
+	e.mu.RLock()
+	policy := e.rejectionPolicy
+	e.mu.RUnlock()
+	if policy == BLOCK_POLICY {
+		return e.submit(j)
+	}
+	return e.offer(j, 0)
+}
+
+// dispatchDetached is dispatch for the futures submitted by the callbacks of other futures, e.g. the steps of a Flow
+// started once the steps they depend on complete. Callbacks run on the workers, so under BLOCK_POLICY a task that can
+// not be queued right away is queued by a new goroutine instead of blocking the worker.
+func (e *ExecutorService) dispatchDetached(j *job) error {
+	e.mu.RLock()
+	policy := e.rejectionPolicy
+	e.mu.RUnlock()
+	if policy != BLOCK_POLICY {
+		return e.offer(j, 0)
+	}
+	e.queueMu.RLock()
+	if e.shutdown {
+		e.queueMu.RUnlock()
+		return ErrExecutorShutdown
+	}
+	select {
+	case e.tasksQueue <- j:
+		e.queueMu.RUnlock()
+		return nil
+	default:
+	}
+	e.queueMu.RUnlock()
+	go func() {
+		if err := e.submit(j); err != nil && j.reject != nil {
+			j.reject(err)
+		}
+	}()
+	return nil
+}
+
+// offer queues the job, applying the rejection policy if there is no space in the queue within the timeout.
+// The rejected jobs are told so once the queue is released, as rejecting a job may run callbacks that queue other jobs.
+func (e *ExecutorService) offer(j *job, timeout time.Duration) error {
+	callerRuns, rejected, err := e.enqueue(j, timeout)
+	for _, r := range rejected {
+		if r.reject == nil {
+			e.handleDiscard(r.run)
+			continue
+		}
+		r.reject(ErrQueueFull)
+	}
+	if callerRuns {
+		e.run(j)
+	}
+	return err
+}
+
+func (e *ExecutorService) enqueue(j *job, timeout time.Duration) (bool, []*job, error) {
+	e.mu.RLock()
+	policy := e.rejectionPolicy
+	e.mu.RUnlock()
+
+	e.queueMu.RLock()
+	defer e.queueMu.RUnlock()
+	if e.shutdown {
+		return false, nil, ErrExecutorShutdown
+	}
+	select {
+	case e.tasksQueue <- j:
+		return false, nil, nil
+	default:
+	}
+	if timeout > 0 {
+		tmr := time.NewTimer(timeout)
+		defer tmr.Stop()
+		select {
+		case e.tasksQueue <- j:
+			return false, nil, nil
+		case <-e.stopping:
+			return false, nil, ErrExecutorShutdown
+		case <-tmr.C:
+		}
+	}
+	return e.rejected(j, policy)
+}
+
+// rejected applies the rejection policy to a job that could not be queued, the caller holds queueMu for reading.
+// Returns true if the job has to be run by the caller, and the jobs to reject once queueMu is released.
+// Under DISCARD_NEWEST_POLICY the job is rejected like under ABORT_POLICY.
+func (e *ExecutorService) rejected(j *job, policy RejectionPolicy) (bool, []*job, error) {
+	var rejected []*job
+	switch policy {
+	case CALLER_RUNS_POLICY:
+		return true, nil, nil
+	case DISCARD_OLDEST_POLICY:
+		select {
+		case oldest := <-e.tasksQueue:
+			rejected = append(rejected, oldest)
+		default:
+		}
+		select {
+		case e.tasksQueue <- j:
+			return false, rejected, nil
+		default:
+		}
+	}
+	if j.reject != nil {
+		rejected = append(rejected, j)
+	}
+	return false, rejected, ErrQueueFull
+}
+
+// submit waits for space in the queue, the wait ends when the service is shutdown.
+func (e *ExecutorService) submit(j *job) error {
+	e.queueMu.RLock()
+	defer e.queueMu.RUnlock()
+	if e.shutdown {
+		return ErrExecutorShutdown
+	}
+	select {
+	case e.tasksQueue <- j:
+		return nil
+	case <-e.stopping:
+		return ErrExecutorShutdown
+	}
+}
+
+// Shutdown stops the service from accepting new tasks, tasks queued already are still run.
+// This method returns immediately, use AwaitTermination() to wait for the queued tasks to complete.
+func (e *ExecutorService) Shutdown() {
+	e.shutdownOnce.Do(func() {
+		close(e.stopping) //releases the submitters waiting for space in the queue, so queueMu can be locked
+		e.queueMu.Lock()
+		e.shutdown = true
+		close(e.tasksQueue)
+		e.queueMu.Unlock()
+		go func() {
+			e.workers.Wait()
+			close(e.terminated)
+		}()
+	})
+}
+
+// ShutdownNow stops the service from accepting new tasks and discards the tasks waiting in the queue.
+// The discarded tasks are returned, futures backed by them are REJECTED with ErrExecutorShutdown.
+// Tasks that are running already are not interrupted.
+func (e *ExecutorService) ShutdownNow() []Task {
+	atomic.StoreInt32(&e.discard, 1)
+	e.Shutdown()
+	for j := range e.tasksQueue {
+		e.drop(j)
+	}
+	//waits for the workers that took a job before the discard was seen, so the jobs they drop are returned as well
+	e.pulling.Lock()
+	defer e.pulling.Unlock()
+
+	e.droppedMu.Lock()
+	defer e.droppedMu.Unlock()
+	notRun := e.dropped
+	e.dropped = nil
+	return notRun
+}
+
+// AwaitTermination blocks until all the workers have exited after a shutdown or the timeout elapses.
+// Returns true if the service terminated, a timeout <= 0 waits forever.
+func (e *ExecutorService) AwaitTermination(timeout time.Duration) bool {
+	if timeout <= 0 {
+		<-e.terminated
+		return true
+	}
+	tmr := time.NewTimer(timeout)
+	defer tmr.Stop()
+	select {
+	case <-e.terminated:
+		return true
+	case <-tmr.C:
+		return false
+	}
+}
+
+func (e *ExecutorService) IsShutdown() bool {
+	e.queueMu.RLock()
+	defer e.queueMu.RUnlock()
+	return e.shutdown
+}
+
+func (e *ExecutorService) IsTerminated() bool {
+	select {
+	case <-e.terminated:
+		return true
+	default:
+		return false
+	}
+}
+
+func (e *ExecutorService) drop(j *job) {
+	if j.reject != nil {
+		j.reject(ErrExecutorShutdown)
+	}
+	e.droppedMu.Lock()
+	e.dropped = append(e.dropped, j.run)
+	e.droppedMu.Unlock()
 }
 
 func (e *ExecutorService) runJobs() {
+	e.workers.Add(e.maxConcurrentTasks)
 	for i := 0; i < e.maxConcurrentTasks; i++ {
 		go func() {
-			for t := range e.tasksQueue {
-				t.execute()
+			defer e.workers.Done()
+			for {
+				e.pulling.RLock()
+				j, ok := <-e.tasksQueue
+				if !ok {
+					e.pulling.RUnlock()
+					return
+				}
+				if atomic.LoadInt32(&e.discard) == 1 {
+					e.drop(j)
+					e.pulling.RUnlock()
+					continue
+				}
+				e.pulling.RUnlock()
+				e.run(j)
 			}
 		}()
 	}
@@ -2,6 +2,8 @@ package workflow
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -29,6 +31,306 @@ func TestExecutorService_MaxConcurrentTasks(t *testing.T) {
 	}
 }
 
+func TestExecutorService_Shutdown_DrainsQueue(t *testing.T) {
+	toTest := NewExecutorService(5, 1)
+	counter := int32(0)
+	for i := 0; i < 5; i++ {
+		toTest.Submit(func() {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&counter, 1)
+		})
+	}
+
+	toTest.Shutdown()
+	if err := toTest.Submit(func() {}); err != ErrExecutorShutdown {
+		t.Errorf("expected ErrExecutorShutdown but got %v", err)
+	}
+	if !toTest.AwaitTermination(time.Second) {
+		t.Errorf("expected executor service to terminate")
+	}
+	if ran := atomic.LoadInt32(&counter); ran != 5 {
+		t.Errorf("expected all 5 queued tasks to run but %d ran", ran)
+	}
+}
+
+func TestExecutorService_ShutdownNow(t *testing.T) {
+	toTest := NewExecutorService(5, 1)
+	started := make(chan struct{})
+	toTest.Submit(func() {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+	})
+	<-started
+	counter := int32(0)
+	for i := 0; i < 3; i++ {
+		toTest.Submit(func() {
+			atomic.AddInt32(&counter, 1)
+		})
+	}
+
+	notRun := toTest.ShutdownNow()
+	if len(notRun) != 3 {
+		t.Errorf("expected 3 tasks not run but got %d", len(notRun))
+	}
+	if !toTest.AwaitTermination(time.Second) {
+		t.Errorf("expected executor service to terminate")
+	}
+	if ran := atomic.LoadInt32(&counter); ran != 0 {
+		t.Errorf("expected discarded tasks not to run but %d ran", ran)
+	}
+}
+
+func TestExecutorService_ShutdownNow_ReturnsEveryTaskNotRun(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		toTest := NewExecutorService(200, 8)
+		counter := int32(0)
+		for i := 0; i < 200; i++ {
+			toTest.Submit(func() {
+				atomic.AddInt32(&counter, 1)
+			})
+		}
+
+		notRun := toTest.ShutdownNow()
+		if !toTest.AwaitTermination(time.Second) {
+			t.Fatalf("expected executor service to terminate")
+		}
+		if ran := atomic.LoadInt32(&counter); int(ran)+len(notRun) != 200 {
+			t.Fatalf("expected every task to be either run or returned but %d ran and %d were returned", ran, len(notRun))
+		}
+	}
+}
+
+func TestExecutorService_AwaitTermination_TimeOut(t *testing.T) {
+	toTest := NewExecutorService(1, 1)
+	if toTest.AwaitTermination(5 * time.Millisecond) {
+		t.Errorf("executor service terminated without a shutdown")
+	}
+	toTest.Shutdown()
+	if !toTest.AwaitTermination(time.Second) || !toTest.IsTerminated() {
+		t.Errorf("expected executor service to terminate")
+	}
+}
+
+func TestExecutorService_ShutdownNow_RejectsFuture(t *testing.T) {
+	toTest := NewExecutorService(1, 1)
+	started := make(chan struct{})
+	toTest.Submit(func() {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+	})
+	<-started
+
+	future, _ := RunAsync(func() bool {
+		return true
+	})
+	future.SetExecutor(toTest).Execute()
+	toTest.ShutdownNow()
+	if _, err := future.Get(time.Second); err != ErrExecutorShutdown {
+		t.Errorf("expected ErrExecutorShutdown but got %v", err)
+	}
+	if future.Stage() != REJECTED {
+		t.Errorf("expected the future to be REJECTED but got %d", future.Stage())
+	}
+}
+
+// busyExecutorService returns a service whose only worker is blocked and whose queue is full,
+// the returned channel releases the worker.
+func busyExecutorService(policy RejectionPolicy) (*ExecutorService, chan struct{}) {
+	es := NewExecutorService(1, 1).SetRejectionPolicy(policy)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	es.Submit(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	es.Submit(func() {})
+	return es, release
+}
+
+func TestExecutorService_TrySubmit_AbortPolicy(t *testing.T) {
+	toTest, release := busyExecutorService(ABORT_POLICY)
+	defer toTest.Shutdown()
+	defer close(release)
+
+	if err := toTest.TrySubmit(func() {}); err != ErrQueueFull {
+		t.Errorf("expected ErrQueueFull but got %v", err)
+	}
+}
+
+func TestExecutorService_TrySubmit_CallerRunsPolicy(t *testing.T) {
+	toTest, release := busyExecutorService(CALLER_RUNS_POLICY)
+	defer toTest.Shutdown()
+	defer close(release)
+
+	ran := false
+	if err := toTest.TrySubmit(func() { ran = true }); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	}
+	if !ran {
+		t.Errorf("expected the task to be run by the caller")
+	}
+}
+
+func TestExecutorService_TrySubmit_DiscardNewestPolicy(t *testing.T) {
+	toTest, release := busyExecutorService(DISCARD_NEWEST_POLICY)
+	defer toTest.Shutdown()
+	defer close(release)
+
+	if err := toTest.TrySubmit(func() {}); err != ErrQueueFull {
+		t.Errorf("expected ErrQueueFull but got %v", err)
+	}
+	if err := toTest.SubmitWithTimeout(func() {}, 5*time.Millisecond); err != ErrQueueFull {
+		t.Errorf("expected ErrQueueFull but got %v", err)
+	}
+	future, _ := RunAsync(func() bool {
+		return true
+	})
+	future.SetExecutor(toTest).Execute()
+	if future.Stage() != REJECTED {
+		t.Errorf("expected the future to be REJECTED but got %d", future.Stage())
+	}
+	if _, err := future.Get(0); err != ErrQueueFull {
+		t.Errorf("expected ErrQueueFull but got %v", err)
+	}
+}
+
+func TestExecutorService_TrySubmit_DiscardOldestPolicy(t *testing.T) {
+	toTest, release := busyExecutorService(DISCARD_OLDEST_POLICY)
+	defer toTest.Shutdown()
+
+	oldest, _ := RunAsync(func() bool {
+		return true
+	})
+	<-toTest.tasksQueue //make space for the oldest future
+	oldest.SetExecutor(toTest).Execute()
+
+	newest, _ := RunAsync(func() bool {
+		return true
+	})
+	newest.SetExecutor(toTest).Execute()
+	close(release)
+
+	if _, err := oldest.Get(0); err != ErrQueueFull {
+		t.Errorf("expected ErrQueueFull but got %v", err)
+	}
+	if get, err := newest.Get(time.Second); err != nil || get[0] != true {
+		t.Errorf("expected newest future to complete but got %v, %v", get, err)
+	}
+}
+
+func TestExecutorService_TrySubmit_DiscardOldestPolicy_Task(t *testing.T) {
+	toTest, release := busyExecutorService(DISCARD_OLDEST_POLICY)
+	defer toTest.Shutdown()
+	discarded := make(chan Task, 1)
+	toTest.SetDiscardHandler(func(task Task) {
+		discarded <- task
+	})
+
+	ran := make(chan bool, 1)
+	if err := toTest.TrySubmit(func() { ran <- true }); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	}
+	close(release)
+
+	select {
+	case <-discarded:
+	case <-time.After(time.Second):
+		t.Errorf("expected the oldest task to be passed to the discard handler")
+	}
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Errorf("expected the newest task to run")
+	}
+}
+
+func TestExecutorService_Rejected_CallbackWhileReconfigured(t *testing.T) {
+	toTest, release := busyExecutorService(ABORT_POLICY)
+
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				toTest.SetPanicHandler(nil)
+			}
+		}
+	}()
+
+	//every rejected future submits its callback, while SetPanicHandler() is waiting for the lock of the service
+	deadline := time.Now().Add(2 * time.Second)
+	var submitters sync.WaitGroup
+	for s := 0; s < 4; s++ {
+		submitters.Add(1)
+		go func() {
+			defer submitters.Done()
+			for time.Now().Before(deadline) {
+				future, _ := RunAsync(func() {})
+				future.SetExecutor(toTest).OnError(func(err error) {}).Execute()
+				future.Get(0)
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		submitters.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("rejecting futures with callbacks deadlocked") //the service is left as it is, shutting it down would block
+	}
+	close(stop)
+	close(release)
+	toTest.Shutdown()
+}
+
+func TestExecutorService_SubmitWithTimeout(t *testing.T) {
+	toTest, release := busyExecutorService(ABORT_POLICY)
+	defer toTest.Shutdown()
+
+	if err := toTest.SubmitWithTimeout(func() {}, 5*time.Millisecond); err != ErrQueueFull {
+		t.Errorf("expected ErrQueueFull but got %v", err)
+	}
+
+	time.AfterFunc(5*time.Millisecond, func() {
+		close(release)
+	})
+	if err := toTest.SubmitWithTimeout(func() {}, time.Second); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	}
+}
+
+func TestExecutorService_Submit_Panic(t *testing.T) {
+	toTest := NewExecutorService(1, 1)
+	defer toTest.Shutdown()
+	handled := make(chan *PanicError, 1)
+	toTest.SetPanicHandler(func(p *PanicError) {
+		handled <- p
+	})
+
+	toTest.Submit(func() {
+		panic("boom")
+	})
+	if p := <-handled; p.Value != "boom" {
+		t.Errorf("expected panic handler to be called with boom but got %v", p.Value)
+	}
+
+	ran := make(chan bool)
+	toTest.Submit(func() {
+		ran <- true
+	})
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Errorf("expected the worker to survive the panic")
+	}
+}
+
 func ExampleExecutorService_Submit_defaultService() {
 	add := func(operands ...int) int {
 		sum := 0
@@ -0,0 +1,253 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// fanOut is run by a MAP step, the target function is called for every element of the slice returned by the previous step.
+type fanOut struct {
+	targetFunc      interface{}
+	concurrency     int     //max elements processed at a time, <= 0 is not limited
+	collect         bool    //results of the target function are passed on instead of the slice processed
+	fold            *folder //results of the target function are folded instead of collected, see ThenReduce()
+	continueOnError bool
+}
+
+// This method creates a new step in the Flow that calls the target function for every element of the slice returned
+// by the previous step, the elements are processed in parallel on the executor of the flow, at most concurrency at a time
+// (<= 0 does not limit it). The first return value of every call is collected in a slice, in the order of the elements,
+// which is passed on to the next step. The step fails with the first element that fails, unless ContinueOnError() is used.
+func (fl *Flow) ThenMap(targetFunc interface{}, concurrency int) *Flow {
+	return fl.addFanOut(targetFunc, concurrency, true)
+}
+
+// This method creates a new step in the Flow that calls the target function for every element of the slice returned
+// by the previous step, like ThenMap() without limiting the concurrency. The slice is passed on to the next step.
+func (fl *Flow) ThenForEach(targetFunc interface{}) *Flow {
+	return fl.addFanOut(targetFunc, 0, false)
+}
+
+// ContinueOnError makes the last step added by ThenMap() or ThenForEach() process every element even if some fail.
+// The step then passes on an error after the slice, an *AggregateError of the elements that failed or nil,
+// the results of the elements that failed are left as zero values.
+func (fl *Flow) ContinueOnError() *Flow {
+	i := len(fl.steps) - 1
+	if fl.steps[i].fanOut == nil {
+		fl.invalid(i, fmt.Errorf("continue on error is supported only by a MAP step"))
+		return fl
+	}
+	fl.steps[i].fanOut.continueOnError = true
+	return fl
+}
+
+func (fl *Flow) addFanOut(targetFunc interface{}, concurrency int, collect bool) *Flow {
+	fl.steps = append(fl.steps, &step{
+		targetFunc: targetFunc,
+		op:         MAP,
+		fanOut:     &fanOut{targetFunc: targetFunc, concurrency: concurrency, collect: collect},
+	})
+
+	targetType := reflect.TypeOf(targetFunc)
+	if targetType == nil || targetType.Kind() != reflect.Func {
+		fl.invalid(len(fl.steps)-1, fmt.Errorf("%T un-supported type", targetFunc))
+	} else if collect && (targetType.NumOut() == 0 || targetType.Out(0) == errorType) {
+		fl.invalid(len(fl.steps)-1, fmt.Errorf("%s has to return a value to be collected", targetType))
+	}
+	return fl
+}
+
+// validate checks that the step is passed a single slice whose elements the target function accepts,
+// returns the types the step passes on, unknown if they are known only at runtime.
+func (m *fanOut) validate(argTypes []reflect.Type, argsUnknown bool) ([]reflect.Type, bool, error) {
+	targetType := reflect.TypeOf(m.targetFunc)
+	var outputs []reflect.Type
+	if !argsUnknown {
+		if len(argTypes) != 1 || argTypes[0] == nil || (argTypes[0].Kind() != reflect.Slice && argTypes[0].Kind() != reflect.Array) {
+			return nil, false, fmt.Errorf("expected a single slice to process but got %v", argTypes)
+		}
+		if err := validateArgs(targetType, []reflect.Type{argTypes[0].Elem()}); err != nil {
+			return nil, false, err
+		}
+		outputs = append(outputs, argTypes[0])
+	}
+	if m.fold != nil {
+		var itemTypes []reflect.Type
+		for o := 0; o < targetType.NumOut(); o++ {
+			if o == targetType.NumOut()-1 && targetType.Out(o) == errorType {
+				break
+			}
+			itemTypes = append(itemTypes, targetType.Out(o))
+		}
+		folded, unknown, err := m.fold.validate([][]reflect.Type{itemTypes})
+		if err != nil || unknown {
+			return nil, unknown, err
+		}
+		outputs = folded
+	} else if m.collect {
+		outputs = []reflect.Type{reflect.SliceOf(targetType.Out(0))}
+	} else if argsUnknown {
+		return nil, true, nil
+	}
+	if m.continueOnError {
+		outputs = append(outputs, errorType)
+	}
+	return outputs, false, nil
+}
+
+// fanOutRun is the progress of a MAP step, an element is started as soon as an element before it is done, see itemDone().
+// It is changed only by the events of the run, which are run one at a time.
+type fanOutRun struct {
+	serializer
+	m         *fanOut
+	ctx       context.Context
+	cancel    context.CancelFunc //elements still running are cancelled when the step fails
+	es        *ExecutorService
+	args      []interface{}
+	items     reflect.Value
+	itemFtrs  []*Future
+	next      int
+	completed int
+	failed    []error
+	results   reflect.Value
+	collector Collector
+	done      func([]interface{}, error)
+	finished  bool
+}
+
+// start calls the target function for every element of the slice in args, done is called with the values passed on
+// by the step once every element is done or an element fails. The elements are not waited for, no worker is held.
+func (m *fanOut) start(ctx context.Context, es *ExecutorService, args []interface{}, done func([]interface{}, error)) {
+	if len(args) != 1 {
+		done(nil, fmt.Errorf("expected a single slice to process but got %d values", len(args)))
+		return
+	}
+	items := reflect.ValueOf(args[0])
+	if items.Kind() != reflect.Slice && items.Kind() != reflect.Array {
+		done(nil, fmt.Errorf("expected a slice to process but got %T", args[0]))
+		return
+	}
+	n := items.Len()
+	run := &fanOutRun{m: m, es: es, args: args, items: items, itemFtrs: make([]*Future, n), failed: make([]error, n), done: done}
+	if m.fold != nil {
+		run.collector = m.fold.start()
+	} else if m.collect {
+		run.results = reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(m.targetFunc).Out(0)), n, n)
+	}
+	run.ctx, run.cancel = context.WithCancel(ctx)
+
+	go func() {
+		<-run.ctx.Done()
+		run.post(func() {
+			run.finish(nil, run.ctx.Err())
+		})
+	}()
+	run.post(func() {
+		limit := m.concurrency
+		if limit <= 0 || limit > n {
+			limit = n
+		}
+		for run.next < limit {
+			if err := run.startItem(); err != nil {
+				run.finish(nil, err)
+				return
+			}
+		}
+		if n == 0 {
+			run.finish(run.output(), nil)
+		}
+	})
+}
+
+// startItem submits the target function for the next element, itemDone() is posted once it is done.
+func (run *fanOutRun) startItem() error {
+	i := run.next
+	item := run.items.Index(i).Interface()
+	if err := validateArgs(reflect.TypeOf(run.m.targetFunc), typesOf([]interface{}{item})); err != nil {
+		return fmt.Errorf("item %d failed with %w", i, err)
+	}
+	itemFtr, err := RunAsyncCtx(run.ctx, run.m.targetFunc, item)
+	if err != nil {
+		return fmt.Errorf("item %d failed with %w", i, err)
+	}
+	itemFtr.SetExecutor(run.es)
+	itemFtr.detached = true
+	run.itemFtrs[i] = itemFtr
+	run.next++
+	itemFtr.whenDone(func() {
+		run.post(func() {
+			run.itemDone(i)
+		})
+	})
+	itemFtr.Execute()
+	return nil
+}
+
+// itemDone collects or folds the results of the i'th element, the step fails with it unless ContinueOnError() is used.
+func (run *fanOutRun) itemDone(i int) {
+	if run.finished {
+		return
+	}
+	m := run.m
+	returned, err := run.itemFtrs[i].Get(0)
+	run.itemFtrs[i] = nil //results are not held once collected or folded
+	if err == nil {
+		returned, err = splitError(m.targetFunc, returned)
+	}
+	if err == nil && run.collector != nil {
+		err = fold(run.collector, returned)
+	}
+	if err != nil {
+		run.failed[i] = fmt.Errorf("item %d failed with %w", i, err)
+		if !m.continueOnError {
+			run.finish(nil, run.failed[i])
+			return
+		}
+	} else if run.collector == nil && m.collect && len(returned) > 0 && returned[0] != nil {
+		run.results.Index(i).Set(reflect.ValueOf(returned[0]))
+	}
+
+	run.completed++
+	if run.next < run.items.Len() {
+		if err := run.startItem(); err != nil {
+			run.finish(nil, err)
+			return
+		}
+	}
+	if run.completed == run.items.Len() {
+		run.finish(run.output(), nil)
+	}
+}
+
+// output returns the values passed on by the step once every element is done.
+func (run *fanOutRun) output() []interface{} {
+	output := run.args[0]
+	if run.collector != nil {
+		output = run.collector.Result()
+	} else if run.m.collect {
+		output = run.results.Interface()
+	}
+	if !run.m.continueOnError {
+		return []interface{}{output}
+	}
+	var errs []error
+	for _, err := range run.failed {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return []interface{}{output, &AggregateError{Errors: errs}}
+	}
+	return []interface{}{output, nil}
+}
+
+func (run *fanOutRun) finish(values []interface{}, err error) {
+	if run.finished {
+		return
+	}
+	run.finished = true
+	run.cancel()
+	run.done(values, err)
+}
@@ -0,0 +1,168 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlow_ThenMap(t *testing.T) {
+	flow := NewFlow(func() []int {
+		return []int{1, 2, 3, 4, 5}
+	}).ThenMap(func(n int) string {
+		time.Sleep(time.Duration(5-n) * 10 * time.Millisecond) //later elements complete first
+		return fmt.Sprintf("#%d", n)
+	}, 0)
+
+	flow.Execute()
+	get, err := flow.Get(time.Second)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if expected := []string{"#1", "#2", "#3", "#4", "#5"}; !reflect.DeepEqual(get[0], expected) {
+		t.Errorf("expected %v in the order of the elements but got %v", expected, get[0])
+	}
+}
+
+func TestFlow_ThenMap_Concurrency(t *testing.T) {
+	running := int32(0)
+	maxRunning := int32(0)
+	flow := NewFlow(func() []int {
+		return []int{1, 2, 3, 4, 5, 6}
+	}).ThenMap(func(n int) int {
+		current := atomic.AddInt32(&running, 1)
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return n * n
+	}, 2).ThenApply(func(squares []int) int {
+		sum := 0
+		for _, square := range squares {
+			sum += square
+		}
+		return sum
+	})
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != 91 {
+		t.Errorf("expected 91 but got %v, %v", get, err)
+	}
+	if max := atomic.LoadInt32(&maxRunning); max > 2 {
+		t.Errorf("expected at most 2 elements processed at a time but got %d", max)
+	}
+}
+
+func TestFlow_ThenMap_Fails(t *testing.T) {
+	odd := errors.New("odd")
+	flow := NewFlow(func() []int {
+		return []int{2, 3, 4}
+	}).ThenMap(func(n int) (int, error) {
+		if n%2 == 1 {
+			return 0, odd
+		}
+		return n, nil
+	}, 1)
+
+	flow.Execute()
+	_, err := flow.Get(time.Second)
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Op != MAP || !errors.Is(err, odd) {
+		t.Errorf("expected the MAP step to fail with %v but got %v", odd, err)
+	}
+}
+
+func TestFlow_ThenMap_ContinueOnError(t *testing.T) {
+	odd := errors.New("odd")
+	flow := NewFlow(func() []int {
+		return []int{1, 2, 3, 4}
+	}).ThenMap(func(n int) (int, error) {
+		if n%2 == 1 {
+			return 0, odd
+		}
+		return n * 10, nil
+	}, 0).ContinueOnError().
+		ThenApply(func(results []int, err error) string {
+			return fmt.Sprintf("%v %v", results, err)
+		})
+
+	flow.Execute()
+	get, err := flow.Get(time.Second)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if expected := "[0 20 0 40] failed with [item 0 failed with odd; item 2 failed with odd]"; get[0] != expected {
+		t.Errorf("expected %q but got %q", expected, get[0])
+	}
+}
+
+func TestFlow_ThenForEach(t *testing.T) {
+	visited := int32(0)
+	flow := NewFlow(func() []string {
+		return []string{"a", "b", "c"}
+	}).ThenForEach(func(s string) {
+		atomic.AddInt32(&visited, 1)
+	}).ThenApply(func(items []string) int {
+		return len(items)
+	})
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != 3 {
+		t.Errorf("expected the slice to be passed on but got %v, %v", get, err)
+	}
+	if atomic.LoadInt32(&visited) != 3 {
+		t.Errorf("expected every element to be visited but got %d", visited)
+	}
+}
+
+func TestFlow_ThenMap_Validate(t *testing.T) {
+	notSlice := NewFlow(func() int { return 1 }).ThenMap(func(n int) int { return n }, 0)
+	if err := notSlice.Validate(); err == nil {
+		t.Errorf("expected an error for a step not returning a slice")
+	}
+
+	mismatch := NewFlow(func() []string { return nil }).ThenMap(func(n int) int { return n }, 0)
+	if err := mismatch.Validate(); err == nil {
+		t.Errorf("expected an error for elements not accepted by the target function")
+	}
+
+	next := NewFlow(func() []int { return nil }).ThenMap(func(n int) string { return "" }, 0).
+		ThenApply(func([]int) {})
+	if err := next.Validate(); err == nil {
+		t.Errorf("expected an error for the next step not accepting the collected results")
+	}
+}
+
+func TestFlow_ThenMap_SingleWorker(t *testing.T) {
+	es := NewExecutorService(10, 1)
+	defer es.Shutdown()
+	flow := NewFlow(func() []int {
+		return []int{1, 2, 3}
+	}).ThenMap(func(n int) int {
+		return n * 2
+	}, 0).ThenReduce(0, func(sum, n int) int {
+		return sum + n
+	}).SetExecutor(es)
+
+	flow.Execute()
+	if get, err := flow.Get(2 * time.Second); err != nil || get[0] != 12 {
+		t.Errorf("expected 12 on a single worker but got %v, %v", get, err)
+	}
+
+	mapped := NewFlow(func() []int {
+		return []int{1, 2, 3}
+	}).ThenMap(func(n int) int {
+		return n * 2
+	}, 2).SetExecutor(es)
+	mapped.Execute()
+	if get, err := mapped.Get(2 * time.Second); err != nil || !reflect.DeepEqual(get[0], []int{2, 4, 6}) {
+		t.Errorf("expected [2 4 6] on a single worker but got %v, %v", get, err)
+	}
+}
@@ -1,9 +1,13 @@
 package workflow
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,8 +18,69 @@ const (
 	AND
 	APPLY
 	COMBINE
+	BRANCH
+	MAP
+	REDUCE
+	RECOVER
 )
 
+var (
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+	// ErrStepTimeout is the error of a step that did not complete within its step timeout, or the budget of the flow.
+	ErrStepTimeout = errors.New("step timedout")
+)
+
+func (o OpType) String() string {
+	switch o {
+	case CALL:
+		return "CALL"
+	case AND:
+		return "AND"
+	case APPLY:
+		return "APPLY"
+	case COMBINE:
+		return "COMBINE"
+	case BRANCH:
+		return "BRANCH"
+	case MAP:
+		return "MAP"
+	case REDUCE:
+		return "REDUCE"
+	case RECOVER:
+		return "RECOVER"
+	default:
+		return fmt.Sprintf("OpType(%d)", int(o))
+	}
+}
+
+// StepError is returned by Flow.Get() when a step of the flow fails, either by returning a non-nil error as its last
+// return value or by the target function not being invoked/completed. It is also returned by Flow.Validate() for
+// a step whose target function does not accept the arguments it would be called with.
+type StepError struct {
+	Index    int    //index of the step in the flow
+	Name     string //name of the target function
+	Step     string //name given to the step, see Named()
+	Op       OpType
+	Attempts int //number of times the target function was called, see WithRetry()
+	Err      error
+}
+
+func (s *StepError) Error() string {
+	stepName := fmt.Sprintf("step %d", s.Index)
+	if s.Step != "" {
+		stepName = fmt.Sprintf("step %d %q", s.Index, s.Step)
+	}
+	if s.Attempts > 1 {
+		return fmt.Sprintf("%s (%s %s) failed after %d attempts with %s", stepName, s.Op, s.Name, s.Attempts, s.Err.Error())
+	}
+	return fmt.Sprintf("%s (%s %s) failed with %s", stepName, s.Op, s.Name, s.Err.Error())
+}
+
+func (s *StepError) Unwrap() error {
+	return s.Err
+}
+
 type step struct {
 	targetFunc   interface{}
 	paramsPassed []interface{}
@@ -23,13 +88,124 @@ type step struct {
 	voidReturn   bool
 	op           OpType
 	future       *Future
+	awaited      *Future //future the step waits for instead of calling a target function
+	retry        *retryPolicy
+	attempts     int32
+	timeout      time.Duration
+	ctx          context.Context //passed to the target function, carries the deadline of the step
+	name         string
+	dependsOn    []string //names of the steps whose results are passed to this step, replaces the implicit APPLY/COMBINE ones
+	branch       *branch  //flows the step chooses from, see ThenIf() and ThenSwitch()
+	fanOut       *fanOut  //calls the target function for every element of a slice, see ThenMap() and ThenForEach()
+	fold         *folder  //folds the results of the steps it depends on, see ThenReduce() and ThenCollect()
+	collector    Collector
+	foldErr      error       //failure of the collector, the REDUCE step fails with it
+	onError      interface{} //substitutes the results of the step when it fails, see OnError()
+	recovered    error       //failure a RECOVER step converts into values
+	compensate   interface{} //undoes the effects of the step when the flow fails, see WithCompensation()
+	outcome      outcome     //guarded by the mutex of the flow, see Results()
+}
+
+// completion is a step that completed, the compensation of the step is called with its values.
+type completion struct {
+	index  int
+	values []interface{}
+}
+
+// returnsTarget reports if the results of the step are the values returned by its target function,
+// which is not the case for BRANCH, MAP, REDUCE and RECOVER steps.
+func (s *step) returnsTarget() bool {
+	return s.branch == nil && s.fanOut == nil && s.fold == nil && s.op != RECOVER
+}
+
+// Collector accumulates the results folded by a step added with ThenCollect(), Add is called with the results of
+// every step or element as they complete, never concurrently. Result is passed on to the next step.
+type Collector interface {
+	Add(values ...interface{}) error
+	Result() interface{}
+}
+
+// folder creates the collector a step folds results into, either for a reducer or a Collector supplied by the user.
+type folder struct {
+	initial      interface{}
+	reducer      interface{}
+	newCollector func() Collector
+}
+
+func (f *folder) start() Collector {
+	if f.newCollector != nil {
+		return f.newCollector()
+	}
+	return &reduction{reducer: f.reducer, acc: f.initial}
+}
+
+// validate checks that the reducer accepts the accumulated value followed by each of items, nil items are known
+// only at runtime. Returns the type of the value folded, unknown for a Collector.
+func (f *folder) validate(items [][]reflect.Type) ([]reflect.Type, bool, error) {
+	if f.newCollector != nil {
+		return nil, true, nil
+	}
+	reducerType := reflect.TypeOf(f.reducer)
+	accType := reducerType.Out(0)
+	for _, itemTypes := range items {
+		if itemTypes == nil {
+			continue
+		}
+		if err := validateArgs(reducerType, append([]reflect.Type{accType}, itemTypes...)); err != nil {
+			return nil, false, err
+		}
+	}
+	return []reflect.Type{accType}, false, nil
+}
+
+// reduction is the Collector of ThenReduce(), the reducer is called with the accumulated value and the results.
+type reduction struct {
+	reducer interface{}
+	acc     interface{}
+}
+
+func (r *reduction) Add(values ...interface{}) error {
+	returned, err := invoke(context.Background(), r.reducer, append([]interface{}{r.acc}, values...))
+	if err == nil {
+		returned, err = splitError(r.reducer, returned)
+	}
+	if err != nil {
+		return err
+	}
+	r.acc = returned[0]
+	return nil
+}
+
+func (r *reduction) Result() interface{} {
+	return r.acc
 }
 
 type Flow struct {
-	steps   []*step
-	future  *Future
-	runOnce sync.Once
-	es      *ExecutorService
+	steps     []*step
+	future    *Future
+	runOnce   sync.Once
+	es        *ExecutorService
+	ctx       context.Context //passed to the target functions accepting a context.Context, cancelled on Cancel() or timeout
+	cancelCtx context.CancelFunc
+	err       error         //reason the flow is not valid
+	budget    time.Duration //time the flow has to complete in from Execute()
+	deadline  time.Time
+	input     []interface{} //appended to the args of the first step, set when the flow is run by a BRANCH step
+	inputs    Inputs        //resolve the placeholders passed to the steps, see ExecuteWith()
+	onError   interface{}   //substitutes the results of the flow when it fails, see OnFlowError()
+	finally   []interface{}
+	state     *FlowState //shared by the steps, passed to the target functions with a *FlowState parameter
+	//compensable steps in the order they completed, used only by the events of the run, see stepDone()
+	completions     []completion
+	compensated     chan struct{} //closed once the compensations are done, or the flow is done without running them
+	compensationErr error
+	running         bool
+	//calls of compensable target functions in progress, the compensations wait for them, see guard()
+	calls    int
+	draining bool         //no compensable target function is called any more
+	drained  func()       //run once the calls in progress return
+	returned []completion //compensable steps whose target function returned, in the order they returned
+	mu       sync.Mutex
 }
 
 func (fl *Flow) SetExecutor(customExecutor *ExecutorService) *Flow {
@@ -40,203 +216,1362 @@ func (fl *Flow) SetExecutor(customExecutor *ExecutorService) *Flow {
 // This method creates a new Flow and adds a step that represents the async execution of the target function.
 // Execute() should be called on the returned flow to trigger the execution of the target function.
 func NewFlow(targetFunc interface{}, args ...interface{}) *Flow {
-	targetType := reflect.TypeOf(targetFunc)
-	switch targetType.Kind() {
-	case reflect.Func:
-		flow := &Flow{}
-		step0 := &step{}
-		step0.targetFunc = targetFunc
-		step0.paramsPassed = args
-		step0.voidReturn = targetType.NumOut() == 0
-		step0.op = CALL
-		flow.steps = append(flow.steps, step0)
-		flow.es = default_es
-		return flow
-	default:
-		fmt.Errorf("%s un-supported type", targetType.Kind())
-		return nil
-	}
+	return NewFlowCtx(context.Background(), targetFunc, args...)
+}
+
+// Same as NewFlow(), the flow is aborted when the ctx is done.
+// Target functions of the flow with a context.Context as the first parameter are passed a context derived from ctx,
+// which is cancelled when the flow is cancelled or timedout.
+func NewFlowCtx(ctx context.Context, targetFunc interface{}, args ...interface{}) *Flow {
+	flow := &Flow{}
+	flow.es = default_es
+	flow.initCtx(ctx, nil)
+	return flow.addStep(CALL, targetFunc, args)
 }
 
 // This method creates a new step in the Flow that represents the async execution of the target function.
 // Step created using this method represents a target function is independent and can be triggered independently.
 func (fl *Flow) AndCall(targetFunc interface{}, args ...interface{}) *Flow {
-	targetType := reflect.TypeOf(targetFunc)
-	switch targetType.Kind() {
-	case reflect.Func:
-		nxtStp := &step{}
-		nxtStp.targetFunc = targetFunc
-		nxtStp.paramsPassed = args
-		nxtStp.voidReturn = targetType.NumOut() == 0
-		nxtStp.op = AND
-		fl.steps = append(fl.steps, nxtStp)
-		return fl
-	default:
-		fmt.Errorf("%s un-supported type", targetType.Kind())
-		return nil
-	}
+	return fl.addStep(AND, targetFunc, args)
+}
+
+// This method creates a new Flow whose first step waits for the future, e.g. the Future() of a Promise.
+// The results of the future are passed on to the next step like the results of a target function.
+func NewFlowFromFuture(future *Future) *Flow {
+	flow := &Flow{}
+	flow.es = default_es
+	flow.initCtx(context.Background(), nil)
+	return flow.addAwaitStep(CALL, future)
+}
+
+// This method creates a new step in the Flow that waits for the future, e.g. the Future() of a Promise.
+// Step created using this method is independent like the one created by AndCall().
+func (fl *Flow) AndAwait(future *Future) *Flow {
+	return fl.addAwaitStep(AND, future)
 }
 
 // This method creates a new step in the Flow that represents the async execution of the target function.
 // Step created using this method represents a target function that combines the results of the previous steps.
 // The argument of this target function should match the return types of the previous steps.
 func (fl *Flow) ThenCombine(targetFunc interface{}) *Flow {
-	targetType := reflect.TypeOf(targetFunc)
-	switch targetType.Kind() {
-	case reflect.Func:
-		nxtStp := &step{}
-		nxtStp.targetFunc = targetFunc
-		nxtStp.voidReturn = targetType.NumOut() == 0
-		nxtStp.op = COMBINE
-		fl.steps = append(fl.steps, nxtStp)
-		return fl
-	default:
-		fmt.Errorf("%s un-supported type", targetType.Kind())
-		return nil
-	}
+	return fl.addStep(COMBINE, targetFunc, nil)
 }
 
 // This method creates a new step in the Flow that represents the async execution of the target function.
 // Step created using this method represents a target function, this step runs after the execution of the previous step.
 // The argument of this target function should match the return types of the previous step.
 func (fl *Flow) ThenApply(targetFunc interface{}) *Flow {
+	return fl.addStep(APPLY, targetFunc, nil)
+}
+
+// WithRetry makes the last step added to the flow call its target function again when it panics or returns a non-nil
+// error as its last return value, up to maxAttempts calls in total. backoff decides how long to wait before each retry,
+// nil retries right away, see ConstantBackoff(), ExponentialBackoff() and JitterBackoff(). retryable decides if the
+// error is worth a retry, nil retries every error. A cancelled or timedout step is not retried.
+// The flow fails with the error of the last attempt, StepError.Attempts tells how many calls were made.
+func (fl *Flow) WithRetry(maxAttempts int, backoff Backoff, retryable func(err error) bool) *Flow {
+	i := len(fl.steps) - 1
+	s := fl.steps[i]
+	var err error
+	if s.awaited != nil || !s.returnsTarget() {
+		err = fmt.Errorf("retry is not supported by a %s step", s.op)
+	} else if maxAttempts < 1 {
+		err = fmt.Errorf("max attempts has to be at least 1, got %d", maxAttempts)
+	}
+	if err != nil {
+		fl.invalid(i, err)
+		return fl
+	}
+	s.retry = &retryPolicy{maxAttempts: maxAttempts, backoff: backoff, retryable: retryable}
+	return fl
+}
+
+// WithStepTimeout makes the last step added to the flow fail with ErrStepTimeout if it does not complete within the
+// timeout, measured from the time the step is submitted. The context.Context passed to the target function carries the deadline.
+// Steps of a flow with a budget time out when the budget is used up, even without a step timeout.
+func (fl *Flow) WithStepTimeout(timeout time.Duration) *Flow {
+	fl.steps[len(fl.steps)-1].timeout = timeout
+	return fl
+}
+
+// WithBudget sets the time the whole flow has to complete in, counted from Execute(). Every step is given what is left
+// of the budget as its deadline, a step that does not complete in time fails with ErrStepTimeout.
+// Unlike the timeout of Get(), the budget is propagated to the target functions accepting a context.Context.
+func (fl *Flow) WithBudget(budget time.Duration) *Flow {
+	fl.budget = budget
+	return fl
+}
+
+// addStep appends a new step to the flow, an un-supported target is reported by Validate().
+func (fl *Flow) addStep(op OpType, targetFunc interface{}, args []interface{}) *Flow {
+	nxtStp := &step{}
+	nxtStp.targetFunc = targetFunc
+	nxtStp.paramsPassed = args
+	nxtStp.op = op
+
 	targetType := reflect.TypeOf(targetFunc)
-	switch targetType.Kind() {
-	case reflect.Func:
-		nxtStp := &step{}
-		nxtStp.targetFunc = targetFunc
+	if targetType == nil || targetType.Kind() != reflect.Func {
+		if fl.err == nil {
+			fl.err = &StepError{
+				Index: len(fl.steps),
+				Name:  fmt.Sprintf("%T", targetFunc),
+				Op:    op,
+				Err:   fmt.Errorf("%T un-supported type", targetFunc),
+			}
+		}
+	} else {
 		nxtStp.voidReturn = targetType.NumOut() == 0
-		nxtStp.op = APPLY
-		fl.steps = append(fl.steps, nxtStp)
+	}
+	fl.steps = append(fl.steps, nxtStp)
+	return fl
+}
+
+func (fl *Flow) addAwaitStep(op OpType, future *Future) *Flow {
+	fl.steps = append(fl.steps, &step{awaited: future, op: op})
+	if future == nil {
+		fl.invalid(len(fl.steps)-1, fmt.Errorf("nil future"))
+	}
+	return fl
+}
+
+// This method creates a new step in the Flow that folds the results of the previous steps, like the ones ThenCombine()
+// would combine, as each of them completes. The reducer is called with the accumulated value, starting with initial,
+// followed by the results of a step, and returns the new accumulated value, which is passed on to the next step.
+// After ThenMap() or ThenForEach() no step is added, instead the MAP step folds the results of every element
+// as it completes, without collecting them in a slice.
+// The order the results are folded in is the order of completion, the reducer should not depend on it.
+// A reducer returning a non-nil error as its last return value, or panicking, fails the step like a target function,
+// the failure is handled by OnError() and Recover().
+func (fl *Flow) ThenReduce(initial interface{}, reducer interface{}) *Flow {
+	var err error
+	reducerType := reflect.TypeOf(reducer)
+	if reducerType == nil || reducerType.Kind() != reflect.Func {
+		err = fmt.Errorf("%T un-supported type", reducer)
+	} else if reducerType.NumIn() == 0 || reducerType.NumOut() == 0 || reducerType.Out(0) == errorType {
+		err = fmt.Errorf("reducer %s has to accept and return the accumulated value", reducerType)
+	} else if initialType := reflect.TypeOf(initial); initialType != nil && !initialType.AssignableTo(reducerType.In(0)) {
+		err = fmt.Errorf("initial value of type %s is not assignable to %s", initialType, reducerType.In(0))
+	}
+	fl.addFold(reducer, &folder{initial: initial, reducer: reducer})
+	if err != nil {
+		fl.invalid(len(fl.steps)-1, err)
+	}
+	return fl
+}
+
+// This method creates a new step in the Flow that adds the results of the previous steps to a Collector as each of
+// them completes, like ThenReduce(). newCollector is called once per run of the flow, the Result() of the collector
+// is passed on to the next step.
+func (fl *Flow) ThenCollect(newCollector func() Collector) *Flow {
+	if newCollector == nil {
+		fl.invalid(len(fl.steps)-1, fmt.Errorf("nil collector"))
 		return fl
-	default:
-		fmt.Errorf("%s un-supported type", targetType.Kind())
-		return nil
 	}
+	return fl.addFold(newCollector, &folder{newCollector: newCollector})
 }
 
-func (fl *Flow) runFlow() ([]interface{}, error) {
+func (fl *Flow) addFold(targetFunc interface{}, fold *folder) *Flow {
+	if last := fl.steps[len(fl.steps)-1]; last.fanOut != nil && last.fanOut.fold == nil {
+		last.fanOut.fold = fold
+		return fl
+	}
+	fl.steps = append(fl.steps, &step{targetFunc: targetFunc, op: REDUCE, fold: fold})
+	return fl
+}
 
-	for i := range fl.steps {
-		currentStp := fl.steps[i]
+// OnError makes the last step added to the flow call the handler with the error the step fails with, the values
+// returned by the handler are passed on instead of the results of the step. The handler is a func accepting an error,
+// returning the same values as the step, if it returns a non-nil error as its last return value the step fails with it.
+// The handler is not called if the flow is cancelled or timed out.
+func (fl *Flow) OnError(handler interface{}) *Flow {
+	i := len(fl.steps) - 1
+	if err := checkHandler(handler); err != nil {
+		fl.invalid(i, err)
+		return fl
+	}
+	fl.steps[i].onError = handler
+	return fl
+}
 
-		switch currentStp.op {
-		case CALL, AND:
-			if callFtr, err := RunAsync(currentStp.targetFunc, currentStp.paramsPassed...); err != nil {
-				fmt.Errorf("%+v step (%d) failed with %s", fl.steps[i].targetFunc, fl.steps[i].op, err.Error())
-				return nil, fmt.Errorf("%+v step (%d) failed with %s", fl.steps[i].targetFunc, fl.steps[i].op, err.Error())
-			} else {
-				currentStp.future = callFtr
-				callFtr.SetExecutor(fl.es).Execute()
-			}
+// OnFlowError makes the flow call the handler with the error the flow fails with, e.g. the *StepError of a step,
+// the values returned by the handler are returned by Get() instead. The handler is a func accepting an error,
+// if it returns a non-nil error as its last return value Get() returns it.
+// The handler is not called if the flow is cancelled or timed out.
+func (fl *Flow) OnFlowError(handler interface{}) *Flow {
+	if err := checkHandler(handler); err != nil {
+		fl.invalid(len(fl.steps)-1, err)
+		return fl
+	}
+	fl.onError = handler
+	return fl
+}
 
-		case APPLY:
-			if stepOutput, err := fl.steps[i-1].future.Get(0); err != nil {
-				fmt.Errorf("%+v step (%d) failed with %s", fl.steps[i-1].targetFunc, fl.steps[i-1].op, err.Error())
-				return nil, fmt.Errorf("%+v step (%d) failed with %s", fl.steps[i-1].targetFunc, fl.steps[i-1].op, err.Error())
-			} else {
-				if applyFtr, err := RunAsync(currentStp.targetFunc, stepOutput...); err != nil {
-					fmt.Errorf("%+v step (%d) failed with %s", fl.steps[i].targetFunc, fl.steps[i].op, err.Error())
-					return nil, fmt.Errorf("%+v step (%d) failed with %s", fl.steps[i].targetFunc, fl.steps[i].op, err.Error())
-				} else {
-					currentStp.future = applyFtr
-					applyFtr.SetExecutor(fl.es).Execute()
-				}
+// This method creates a new step in the Flow that passes on the results of the previous step, or if one of the
+// steps it depends on fails, the values returned by the handler called with the *StepError of the failed step.
+// The steps between the failed step and the RECOVER step that depend on the failed step are not run.
+// The handler is a func accepting an error and returning the same values as the previous step.
+func (fl *Flow) Recover(handler interface{}) *Flow {
+	fl.steps = append(fl.steps, &step{targetFunc: handler, op: RECOVER})
+	if err := checkHandler(handler); err != nil {
+		fl.invalid(len(fl.steps)-1, err)
+	}
+	return fl
+}
+
+// Finally registers fn to be called once the flow is done, whether it completed, failed, was cancelled or timedout.
+// fn either accepts no parameters or an error, which is passed the error Get() returns, nil if the flow completed.
+// Finally functions are called in the order they are registered, on the executor of the flow,
+// steps that are running when the flow is cancelled may still be running when they are called.
+func (fl *Flow) Finally(fn interface{}) *Flow {
+	fnType := reflect.TypeOf(fn)
+	if fnType == nil || fnType.Kind() != reflect.Func {
+		fl.invalid(len(fl.steps)-1, fmt.Errorf("%T un-supported type", fn))
+	} else if fnType.NumIn() > 1 || (fnType.NumIn() == 1 && fnType.In(0) != errorType) {
+		fl.invalid(len(fl.steps)-1, fmt.Errorf("finally %s has to accept no parameters or an error", fnType))
+	} else {
+		fl.finally = append(fl.finally, fn)
+	}
+	return fl
+}
+
+// checkHandler checks that the error handler is a func accepting an error.
+func checkHandler(handler interface{}) error {
+	handlerType := reflect.TypeOf(handler)
+	if handlerType == nil || handlerType.Kind() != reflect.Func {
+		return fmt.Errorf("%T un-supported type", handler)
+	}
+	return validateArgs(handlerType, []reflect.Type{errorType})
+}
+
+// checkFallback checks that the handler returns values assignable to the results it substitutes.
+func checkFallback(handler interface{}, results []reflect.Type) error {
+	var returned []reflect.Type
+	handlerType := reflect.TypeOf(handler)
+	for o := 0; o < handlerType.NumOut(); o++ {
+		if o == handlerType.NumOut()-1 && handlerType.Out(o) == errorType {
+			break
+		}
+		returned = append(returned, handlerType.Out(o))
+	}
+	if len(returned) != len(results) {
+		return fmt.Errorf("handler %s returns %d values, expected %d", handlerType, len(returned), len(results))
+	}
+	for o := range returned {
+		if !returned[o].AssignableTo(results[o]) {
+			return fmt.Errorf("value %d of type %s returned by handler is not assignable to %s", o, returned[o], results[o])
+		}
+	}
+	return nil
+}
+
+// fallback calls the handler with err, returns the values that substitute the failed results.
+func fallback(ctx context.Context, handler interface{}, err error) ([]interface{}, error) {
+	returned, err := invoke(ctx, handler, []interface{}{err})
+	if err != nil {
+		return nil, err
+	}
+	return splitError(handler, returned)
+}
+
+// WithCompensation registers the function undoing the effects of the last step added to the flow, e.g. a refund for a
+// payment. When the flow fails, is cancelled or timedout, the compensations of the steps that completed are called in
+// the reverse order the steps completed, one at a time on the executor of the flow. A compensation is passed the values
+// the step passed on, it fails if it panics or returns a non-nil error as its last return value.
+// The flow still fails with the original error, see CompensationErr() for the compensations that failed.
+// The compensations wait for the target functions of the compensable steps that are running when the flow fails,
+// a step completing after the flow failed is compensated as well, its results are still dropped.
+func (fl *Flow) WithCompensation(compensate interface{}) *Flow {
+	i := len(fl.steps) - 1
+	compensateType := reflect.TypeOf(compensate)
+	if compensateType == nil || compensateType.Kind() != reflect.Func {
+		fl.invalid(i, fmt.Errorf("%T un-supported type", compensate))
+		return fl
+	}
+	fl.steps[i].compensate = compensate
+	return fl
+}
+
+// Step adds a named step that calls the target function, like AndCall() followed by Named().
+// Use DependsOn() to pass it the results of other steps, the steps of a flow form a graph in which every step
+// is submitted as soon as the steps it depends on complete.
+func (fl *Flow) Step(name string, targetFunc interface{}, args ...interface{}) *Flow {
+	return fl.AndCall(targetFunc, args...).Named(name)
+}
+
+// Named names the last step added to the flow, so that other steps can depend on it, see DependsOn().
+// Names have to be unique within the flow.
+func (fl *Flow) Named(name string) *Flow {
+	i := len(fl.steps) - 1
+	if name == "" {
+		fl.invalid(i, fmt.Errorf("step name can not be empty"))
+		return fl
+	}
+	for p, s := range fl.steps {
+		if p != i && s.name == name {
+			fl.invalid(i, fmt.Errorf("step name %q is used by step %d", name, p))
+			return fl
+		}
+	}
+	fl.steps[i].name = name
+	return fl
+}
+
+// DependsOn makes the last step added to the flow wait for the named steps, their results are passed to the target
+// function in the order of the names, after the args passed when the step was added.
+// For a step added by ThenApply() or ThenCombine() the named steps replace the previous step(s) it would use.
+// Steps can depend on steps added after them, as long as the dependencies do not form a cycle.
+func (fl *Flow) DependsOn(names ...string) *Flow {
+	i := len(fl.steps) - 1
+	if fl.steps[i].awaited != nil {
+		fl.invalid(i, fmt.Errorf("a step awaiting a future can not depend on other steps"))
+		return fl
+	}
+	fl.steps[i].dependsOn = append(fl.steps[i].dependsOn, names...)
+	return fl
+}
+
+// invalid records the reason the i'th step makes the flow invalid, the first reason is reported by Validate().
+func (fl *Flow) invalid(i int, err error) {
+	if fl.err == nil {
+		fl.err = fl.stepError(i, err)
+	}
+}
+
+// Validate checks that the arguments passed to every step match the parameters of its target function, for
+// APPLY and COMBINE steps the values returned by the previous step(s) are checked, without submitting anything
+// to the executor. Execute() validates the flow, Get() returns the error if the flow is not valid.
+func (fl *Flow) Validate() error {
+	return fl.validate(typesOf(fl.input), false)
+}
+
+// validate checks the flow with the first step being passed arguments of inputTypes after its own args,
+// inputUnknown is true if the types are known only at runtime.
+func (fl *Flow) validate(inputTypes []reflect.Type, inputUnknown bool) error {
+	_, _, err := fl.resultTypes(inputTypes, inputUnknown)
+	return err
+}
+
+// resultTypes checks the flow like validate() and returns the types of the values passed on by its last step,
+// unknown if they are known only at runtime.
+func (fl *Flow) resultTypes(inputTypes []reflect.Type, inputUnknown bool) ([]reflect.Type, bool, error) {
+	if fl.err != nil {
+		return nil, false, fl.err
+	}
+
+	deps, order, err := fl.graph()
+	if err != nil {
+		return nil, false, err
+	}
+
+	outputs := make([][]reflect.Type, len(fl.steps))
+	unknown := make([]bool, len(fl.steps)) //results of awaited futures are known only at runtime
+	for _, i := range order {
+		s := fl.steps[i]
+		if s.awaited != nil {
+			unknown[i] = true
+			continue
+		}
+
+		argTypes := typesOf(s.paramsPassed)
+		argsUnknown, err := checkPlaceholders(s.paramsPassed) //placeholders are known once the inputs are supplied
+		if err != nil {
+			return nil, false, fl.stepError(i, err)
+		}
+		if i == 0 {
+			argTypes = append(argTypes, inputTypes...)
+			argsUnknown = argsUnknown || inputUnknown
+		}
+		for _, p := range deps[i] {
+			argTypes = append(argTypes, outputs[p]...)
+			argsUnknown = argsUnknown || unknown[p]
+		}
+
+		if s.branch != nil {
+			if outputs[i], unknown[i], err = s.branch.validate(argTypes, argsUnknown); err != nil {
+				return nil, false, fl.stepError(i, err)
+			}
+			continue
+		}
+		if s.fanOut != nil {
+			if outputs[i], unknown[i], err = s.fanOut.validate(argTypes, argsUnknown); err != nil {
+				return nil, false, fl.stepError(i, err)
 			}
-		case COMBINE:
-			var allResponses []interface{}
-			start := 0
-			for p := 0; p < i; p++ {
-				if fl.steps[p].op == APPLY || fl.steps[p].op == COMBINE {
-					start = p
+			continue
+		}
+		if s.op == RECOVER {
+			if !argsUnknown {
+				if err := checkFallback(s.targetFunc, argTypes); err != nil {
+					return nil, false, fl.stepError(i, err)
 				}
 			}
-			for p := start; p < i; p++ {
-				if pCallFtr, err := fl.steps[p].future.Get(0); err != nil {
-					fmt.Errorf("%+v step (%d) failed with %s", fl.steps[p].targetFunc, fl.steps[p].op, err.Error())
-					return nil, fmt.Errorf("%+v step (%d) failed with %s", fl.steps[p].targetFunc, fl.steps[p].op, err.Error())
+			outputs[i], unknown[i] = argTypes, argsUnknown
+			continue
+		}
+		if s.op == REDUCE {
+			items := make([][]reflect.Type, 0, len(deps[i]))
+			for _, p := range deps[i] {
+				if unknown[p] {
+					items = append(items, nil)
 				} else {
-					allResponses = append(allResponses, pCallFtr...)
+					items = append(items, append([]reflect.Type{}, outputs[p]...))
+				}
+			}
+			if outputs[i], unknown[i], err = s.fold.validate(items); err != nil {
+				return nil, false, fl.stepError(i, err)
+			}
+			continue
+		}
+		targetType := reflect.TypeOf(s.targetFunc)
+		if !argsUnknown {
+			if err := validateArgs(targetType, argTypes); err != nil {
+				return nil, false, fl.stepError(i, err)
+			}
+		}
+		for o := 0; o < targetType.NumOut(); o++ {
+			if o == targetType.NumOut()-1 && targetType.Out(o) == errorType {
+				break
+			}
+			outputs[i] = append(outputs[i], targetType.Out(o))
+		}
+	}
+
+	for i, s := range fl.steps {
+		if s.onError != nil && !unknown[i] {
+			if err := checkFallback(s.onError, outputs[i]); err != nil {
+				return nil, false, fl.stepError(i, err)
+			}
+		}
+		if s.compensate != nil && !unknown[i] {
+			if err := validateArgs(reflect.TypeOf(s.compensate), outputs[i]); err != nil {
+				return nil, false, fl.stepError(i, fmt.Errorf("compensation not valid: %w", err))
+			}
+		}
+	}
+	last := len(fl.steps) - 1
+	return outputs[last], unknown[last], nil
+}
+
+// graph resolves the indexes of the steps each step depends on, and orders the steps so that every step comes after
+// the steps it depends on. Steps added by ThenApply() and ThenCombine() depend on the previous step(s) unless DependsOn() is used.
+func (fl *Flow) graph() ([][]int, []int, error) {
+	names := make(map[string]int)
+	for i, s := range fl.steps {
+		if s.name != "" {
+			names[s.name] = i
+		}
+	}
+
+	deps := make([][]int, len(fl.steps))
+	dependents := make([][]int, len(fl.steps))
+	pending := make([]int, len(fl.steps))
+	for i, s := range fl.steps {
+		switch {
+		case s.dependsOn != nil:
+			for _, name := range s.dependsOn {
+				p, ok := names[name]
+				if !ok {
+					return nil, nil, fl.stepError(i, fmt.Errorf("depends on unknown step %q", name))
 				}
+				deps[i] = append(deps[i], p)
+			}
+		case s.op == APPLY || s.op == BRANCH || s.op == MAP || s.op == RECOVER:
+			deps[i] = []int{i - 1}
+		case s.op == COMBINE || s.op == REDUCE:
+			for p := combineStart(fl.steps, i); p < i; p++ {
+				deps[i] = append(deps[i], p)
+			}
+		}
+		pending[i] = len(deps[i])
+		for _, p := range deps[i] {
+			dependents[p] = append(dependents[p], i)
+		}
+	}
+
+	order := make([]int, 0, len(fl.steps))
+	for i := range fl.steps {
+		if pending[i] == 0 {
+			order = append(order, i)
+		}
+	}
+	for o := 0; o < len(order); o++ {
+		for _, d := range dependents[order[o]] {
+			pending[d]--
+			if pending[d] == 0 {
+				order = append(order, d)
+			}
+		}
+	}
+	for i := range fl.steps {
+		if pending[i] > 0 {
+			return nil, nil, fl.stepError(i, fmt.Errorf("dependencies of the step form a cycle"))
+		}
+	}
+	return deps, order, nil
+}
+
+// combineStart returns the index of the first step whose results are combined by the i'th step,
+// i.e. the last step that is not independent.
+func combineStart(steps []*step, i int) int {
+	start := 0
+	for p := 0; p < i; p++ {
+		if steps[p].op != CALL && steps[p].op != AND {
+			start = p
+		}
+	}
+	return start
+}
+
+// runState is the progress of a single execution of the steps of a flow. Steps are started by the events posted as the
+// steps they depend on complete, so neither a goroutine nor a worker of the executor waits for the steps while the flow
+// runs. It is changed only by the events, which are run one at a time.
+type runState struct {
+	serializer
+	flowFtr    *Future
+	deps       [][]int
+	dependents [][]int
+	pending    []int
+	started    []bool
+	settled    []bool          //completed, or skipped after a failure handled by a RECOVER step
+	outputs    [][]interface{} //results folded by REDUCE steps are not held, unless other steps need them
+	values     []interface{}   //passed on by the last step, returned by the flow
+	left       int
+	done       bool
+	stopped    chan struct{} //closed once the run is done
+}
+
+// runFlow starts the steps that depend on no other step, the rest are started by stepDone() as the steps complete.
+// The flow future is done once every step is done or a step fails, after the compensations are called.
+func (fl *Flow) runFlow(flowFtr *Future) {
+	fl.mu.Lock()
+	if fl.running = !isClosed(fl.compensated); !fl.running {
+		fl.mu.Unlock()
+		return
+	}
+	fl.mu.Unlock()
+
+	deps, _, _ := fl.graph() //the flow is validated by Execute()
+	r := &runState{
+		flowFtr:    flowFtr,
+		deps:       deps,
+		dependents: make([][]int, len(fl.steps)),
+		pending:    make([]int, len(fl.steps)),
+		started:    make([]bool, len(fl.steps)),
+		settled:    make([]bool, len(fl.steps)),
+		outputs:    make([][]interface{}, len(fl.steps)),
+		left:       len(fl.steps),
+		stopped:    make(chan struct{}),
+	}
+	for i := range fl.steps {
+		r.pending[i] = len(deps[i])
+		for _, p := range deps[i] {
+			r.dependents[p] = append(r.dependents[p], i)
+		}
+	}
+	for _, s := range fl.steps {
+		if s.op == REDUCE {
+			s.collector = s.fold.start()
+		}
+	}
+
+	go func() {
+		select {
+		case <-fl.ctx.Done():
+			r.post(func() {
+				fl.endRun(r, nil, fl.ctx.Err())
+			})
+		case <-r.stopped:
+		}
+	}()
+	r.post(func() {
+		for i := range fl.steps {
+			if r.pending[i] == 0 {
+				fl.startStep(r, i, nil)
+			}
+		}
+	})
+}
+
+// endRun marks the run done with the values or the error the flow failed with. The compensations and the error
+// handler of the flow are called on the executor, the flow future is done once they return.
+func (fl *Flow) endRun(r *runState, values []interface{}, err error) {
+	if r.done {
+		return
+	}
+	r.done = true
+	close(r.stopped)
+	if err != nil && fl.ctx.Err() != nil {
+		fl.cancelSteps(-1)
+	}
+
+	finish := func() {
+		var compensationErr error
+		if err != nil {
+			compensationErr = fl.compensate()
+		}
+		fl.mu.Lock()
+		fl.compensationErr = compensationErr
+		close(fl.compensated)
+		fl.mu.Unlock()
+
+		if ctxErr := fl.ctx.Err(); ctxErr != nil {
+			r.flowFtr.finish(ABORTED, nil, ctxErr)
+			return
+		}
+		if err != nil && fl.onError != nil {
+			values, err = fallback(fl.ctx, fl.onError, err)
+		}
+		r.flowFtr.settle([]interface{}{values, err}, nil)
+	}
+	if err != nil {
+		fl.afterCalls(finish)
+	} else {
+		fl.es.submitCallback(finish)
+	}
+}
+
+// afterCalls stops the compensable target functions from being called and submits fn once the calls in progress return.
+func (fl *Flow) afterCalls(fn func()) {
+	fl.mu.Lock()
+	fl.draining = true
+	if fl.calls > 0 {
+		fl.drained = fn
+		fn = nil
+	}
+	fl.mu.Unlock()
+	if fn != nil {
+		fl.es.submitCallback(fn)
+	}
+}
+
+// guard wraps the calls of the target function of the i'th step, a compensable step, so that the compensations wait
+// for a call in progress when the flow fails. A call that returns without an error is recorded to be compensated,
+// even if the flow stopped waiting for the step, e.g. after another step failed or the step timedout.
+func (fl *Flow) guard(i int) func(call func() []interface{}) {
+	s := fl.steps[i]
+	return func(call func() []interface{}) {
+		fl.mu.Lock()
+		if fl.draining {
+			fl.mu.Unlock()
+			return
+		}
+		fl.calls++
+		fl.mu.Unlock()
+
+		var values []interface{}
+		succeeded := false
+		defer func() {
+			fl.mu.Lock()
+			if succeeded {
+				fl.returned = append(fl.returned, completion{index: i, values: values})
+			}
+			fl.calls--
+			var drained func()
+			if fl.calls == 0 {
+				drained, fl.drained = fl.drained, nil
+			}
+			fl.mu.Unlock()
+			if drained != nil {
+				fl.es.submitCallback(drained)
+			}
+		}()
+		var err error
+		values, err = splitError(s.targetFunc, call())
+		succeeded = err == nil
+	}
+}
+
+// serializer runs the events posted to it one at a time, in the order they are posted, on the goroutine that posted
+// the first of them. An event posted while another one runs is queued, so an event can post events, e.g. a step run by
+// the goroutine starting it (CALLER_RUNS_POLICY) completes before the event starting it returns.
+type serializer struct {
+	eventsMu sync.Mutex
+	events   []func()
+	posting  bool
+}
+
+func (sr *serializer) post(event func()) {
+	sr.eventsMu.Lock()
+	sr.events = append(sr.events, event)
+	if sr.posting {
+		sr.eventsMu.Unlock()
+		return
+	}
+	sr.posting = true
+	for len(sr.events) > 0 {
+		next := sr.events[0]
+		sr.events = sr.events[1:]
+		sr.eventsMu.Unlock()
+		next()
+		sr.eventsMu.Lock()
+	}
+	sr.posting = false
+	sr.eventsMu.Unlock()
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// compensate calls the compensations of the steps that completed, the last one to complete first. The steps whose
+// target function returned after the flow stopped waiting for them completed last.
+// Returns an *AggregateError of the compensations that failed, nil if none failed.
+func (fl *Flow) compensate() error {
+	completions := fl.completions
+	seen := make(map[int]bool, len(completions))
+	for _, done := range completions {
+		seen[done.index] = true
+	}
+	fl.mu.Lock()
+	for _, done := range fl.returned {
+		if !seen[done.index] {
+			seen[done.index] = true
+			completions = append(completions, done)
+		}
+	}
+	fl.mu.Unlock()
+
+	var errs []error
+	for c := len(completions) - 1; c >= 0; c-- {
+		done := completions[c]
+		compensate := fl.steps[done.index].compensate
+		returned, err := invoke(fl.stateCtx(), compensate, done.values)
+		if err == nil {
+			_, err = splitError(compensate, returned)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("compensation of step %d failed with %w", done.index, err))
+		}
+	}
+	if len(errs) > 0 {
+		return &AggregateError{Errors: errs}
+	}
+	return nil
+}
+
+// stepDone handles the i'th step once it is done, the steps depending on it are started when it completes.
+// A failure of the step is handled by a RECOVER step after it, or fails the flow.
+func (fl *Flow) stepDone(r *runState, i int) {
+	fl.mu.Lock()
+	fl.steps[i].outcome.finished = time.Now()
+	fl.mu.Unlock()
+	if r.done || r.settled[i] {
+		return
+	}
+	if err := fl.ctx.Err(); err != nil {
+		fl.endRun(r, nil, err)
+		return
+	}
+	r.settled[i] = true
+	r.left--
+
+	stepOutput, err := fl.stepOutput(i)
+	if err == nil && foldedOnly(fl.steps, r.dependents[i]) {
+		fl.recordFolded(i)
+	} else {
+		fl.record(i, stepOutput, err)
+	}
+	if err != nil {
+		rc := recoverer(fl.steps, r.deps, i)
+		if rc < 0 {
+			fl.cancelSteps(i)
+			fl.endRun(r, nil, err)
+			return
+		}
+		for _, skipped := range skippedBy(r.dependents, i, rc) {
+			if !r.settled[skipped] {
+				r.settled[skipped] = true
+				r.left--
+				fl.cancelStep(skipped)
+			}
+		}
+		if !r.started[rc] {
+			fl.steps[rc].recovered = err
+			fl.startStep(r, rc, nil)
+		}
+		//otherwise the RECOVER step handles the failure of another step already, this one is handled along with it
+		if r.left == 0 {
+			fl.endRun(r, r.values, nil)
+		}
+		return
+	}
+	if fl.steps[i].compensate != nil {
+		fl.completions = append(fl.completions, completion{index: i, values: stepOutput})
+	}
+	if i == len(fl.steps)-1 {
+		r.values = stepOutput
+	}
+	for _, d := range r.dependents[i] {
+		if collector := fl.steps[d].collector; collector == nil {
+			r.outputs[i] = stepOutput
+		} else if r.started[d] || r.settled[d] {
+			continue //the REDUCE step failed already
+		} else if err := fold(collector, stepOutput); err != nil {
+			//the REDUCE step is started right away to fail like any other step, see launch()
+			fl.steps[d].foldErr = err
+			fl.startStep(r, d, nil)
+		}
+	}
+
+	for _, d := range r.dependents[i] {
+		r.pending[d]--
+		if r.pending[d] > 0 {
+			continue
+		}
+		var depOutputs []interface{}
+		for _, p := range r.deps[d] {
+			depOutputs = append(depOutputs, r.outputs[p]...)
+		}
+		fl.startStep(r, d, depOutputs)
+	}
+	if r.left == 0 {
+		fl.endRun(r, r.values, nil)
+	}
+}
+
+// foldedOnly reports if the results of a step are used only by the REDUCE steps depending on it.
+func foldedOnly(steps []*step, dependents []int) bool {
+	for _, d := range dependents {
+		if steps[d].collector == nil {
+			return false
+		}
+	}
+	return len(dependents) > 0
+}
+
+// recoverer returns the index of the RECOVER step handling the failure of the i'th step, the first one after it
+// that depends on it, -1 if there is none.
+func recoverer(steps []*step, deps [][]int, i int) int {
+	for r := i + 1; r < len(steps); r++ {
+		if steps[r].op == RECOVER && dependsOn(deps, r, i) {
+			return r
+		}
+	}
+	return -1
+}
+
+// dependsOn reports if the step d depends on the step i, directly or through other steps.
+func dependsOn(deps [][]int, d, i int) bool {
+	for _, p := range deps[d] {
+		if p == i || dependsOn(deps, p, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// skippedBy returns the steps that are not run when the i'th step fails and the r'th step recovers from it,
+// the steps depending on the i'th step except the RECOVER step and the steps after it.
+func skippedBy(dependents [][]int, i, r int) []int {
+	var skipped []int
+	seen := map[int]bool{i: true, r: true}
+	for queue := []int{i}; len(queue) > 0; queue = queue[1:] {
+		for _, d := range dependents[queue[0]] {
+			if !seen[d] {
+				seen[d] = true
+				skipped = append(skipped, d)
+				queue = append(queue, d)
+			}
+		}
+	}
+	return skipped
+}
+
+// startStep submits the i'th step with the results of the steps it depends on, stepDone() is posted once it is done.
+// A step with a deadline is aborted when the deadline is reached, the flow does not wait for it any longer.
+func (fl *Flow) startStep(r *runState, i int, depOutputs []interface{}) {
+	if r.done || r.started[i] || r.settled[i] {
+		return
+	}
+	r.started[i] = true
+	s := fl.steps[i]
+	release := fl.stepCtx(s)
+	args := s.paramsPassed
+	if i == 0 && len(fl.input) > 0 {
+		depOutputs = append(append([]interface{}{}, fl.input...), depOutputs...)
+	}
+	if len(depOutputs) > 0 {
+		args = append(append([]interface{}{}, s.paramsPassed...), depOutputs...)
+	}
+	stepFtr, err := fl.launch(i, args)
+	if err != nil {
+		release()
+		err = fl.stepFailed(i, err)
+		fl.record(i, nil, err)
+		fl.endRun(r, nil, err)
+		return
+	}
+	stepFtr.detached = true
+	stepFtr.timesOut = true
+
+	fl.mu.Lock()
+	s.future = stepFtr
+	s.outcome.started = time.Now()
+	fl.mu.Unlock()
+	stepFtr.whenDone(release)
+	stepFtr.whenDone(func() {
+		r.post(func() {
+			fl.stepDone(r, i)
+		})
+	})
+	if s.ctx != fl.ctx {
+		go func() {
+			select {
+			case <-s.ctx.Done():
+				stepFtr.finish(stepFtr.ctxStage(s.ctx.Err()), nil, s.ctx.Err())
+			case <-stepFtr.Done():
+			}
+		}()
+	}
+	stepFtr.Execute()
+}
+
+// stepCtx sets the context of the step, with the earliest of the step timeout and the deadline of the flow.
+// The returned func releases the context once the step is done.
+func (fl *Flow) stepCtx(s *step) func() {
+	deadline := fl.deadline
+	if s.timeout > 0 {
+		if stepDeadline := time.Now().Add(s.timeout); deadline.IsZero() || stepDeadline.Before(deadline) {
+			deadline = stepDeadline
+		}
+	}
+	if deadline.IsZero() {
+		s.ctx = fl.ctx
+		return func() {}
+	}
+	ctx, cancel := context.WithDeadline(fl.ctx, deadline)
+	s.ctx = ctx
+	return cancel
+}
+
+// launch creates the future of the step, the future of a step with a retry policy completes with the outcome
+// of its last attempt.
+func (fl *Flow) launch(i int, args []interface{}) (*Future, error) {
+	s := fl.steps[i]
+	if s.awaited != nil {
+		return fl.launchAwait(s), nil
+	}
+	if s.branch != nil {
+		return fl.launchAsync(s, func(ctx context.Context, done func([]interface{}, error)) {
+			s.branch.start(ctx, fl.es, fl.inputs, args, done)
+		}), nil
+	}
+	if s.fanOut != nil {
+		return fl.launchAsync(s, func(ctx context.Context, done func([]interface{}, error)) {
+			s.fanOut.start(ctx, fl.es, args, done)
+		}), nil
+	}
+	if s.collector != nil {
+		return fl.launchRun(s, func(ctx context.Context) ([]interface{}, error) {
+			if s.foldErr != nil {
+				return nil, s.foldErr
 			}
-			if combinedFtr, err := RunAsync(currentStp.targetFunc, allResponses...); err != nil {
-				fmt.Errorf("%+v step (%d) failed with %s", fl.steps[i].targetFunc, fl.steps[i].op, err.Error())
-				return nil, fmt.Errorf("%+v step (%d) failed with %s", fl.steps[i].targetFunc, fl.steps[i].op, err.Error())
+			return []interface{}{s.collector.Result()}, nil
+		}), nil
+	}
+	if s.op == RECOVER {
+		return fl.launchRun(s, func(ctx context.Context) ([]interface{}, error) {
+			if s.recovered == nil {
+				return args, nil
+			}
+			return fallback(ctx, s.targetFunc, s.recovered)
+		}), nil
+	}
+	if err := validateArgs(reflect.TypeOf(s.targetFunc), typesOf(args)); err != nil {
+		//args known only at runtime, e.g. the results of an awaited future, fail the step like any other failure
+		stepFtr := newFuture(s.ctx)
+		stepFtr.es = fl.es
+		stepFtr.trigger = func() {
+			stepFtr.settle(nil, err)
+		}
+		return stepFtr, nil
+	}
+	if s.retry == nil {
+		stepFtr, err := RunAsyncCtx(s.ctx, s.targetFunc, args...)
+		if err != nil {
+			return nil, err
+		}
+		if s.compensate != nil {
+			stepFtr.around = fl.guard(i)
+		}
+		atomic.StoreInt32(&s.attempts, 1)
+		return stepFtr.SetExecutor(fl.es), nil
+	}
+	if _, err := RunAsyncCtx(s.ctx, s.targetFunc, args...); err != nil {
+		return nil, err
+	}
+	stepFtr := newFuture(s.ctx)
+	stepFtr.es = fl.es
+	stepFtr.trigger = func() {
+		fl.attempt(i, stepFtr, args)
+	}
+	return stepFtr, nil
+}
+
+// fold adds the values to the collector, a panic of the collector is returned as a *PanicError.
+func fold(collector Collector, values []interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = newPanicError(r)
+		}
+	}()
+	return collector.Add(values...)
+}
+
+// launchRun creates the future of a step whose results are computed by run instead of its target function,
+// the future completes with the values returned by run.
+func (fl *Flow) launchRun(s *step, run func(ctx context.Context) ([]interface{}, error)) *Future {
+	stepFtr := newFuture(s.ctx)
+	stepFtr.es = fl.es
+	stepFtr.trigger = func() {
+		runFtr, _ := RunAsyncCtx(stepFtr.ctx, run)
+		runFtr.SetExecutor(fl.es)
+		runFtr.detached = true
+		runFtr.whenDone(func() {
+			if runFtr.err != nil {
+				stepFtr.adopt(runFtr)
+			} else if err, _ := runFtr.funcReturned[1].(error); err != nil {
+				stepFtr.settle(nil, err)
 			} else {
-				currentStp.future = combinedFtr
-				combinedFtr.SetExecutor(fl.es).Execute()
+				stepFtr.settle(runFtr.funcReturned[0].([]interface{}), nil)
 			}
+		})
+		runFtr.Execute()
+	}
+	atomic.StoreInt32(&s.attempts, 1)
+	return stepFtr
+}
+
+// launchAwait creates the future of a step awaiting a future, it adopts the outcome of the awaited future once it is
+// done. The step is timed out or cancelled on its own future, the awaited one, e.g. the future of a Promise, is not changed.
+func (fl *Flow) launchAwait(s *step) *Future {
+	stepFtr := newFuture(s.ctx)
+	stepFtr.es = fl.es
+	stepFtr.trigger = func() {
+		s.awaited.Execute()
+		s.awaited.whenDone(func() {
+			stepFtr.adopt(s.awaited)
+		})
+	}
+	return stepFtr
+}
+
+// launchAsync creates the future of a step whose results are computed by start instead of its target function.
+// start submits the work and returns without waiting for it, the future completes with the values passed to done.
+func (fl *Flow) launchAsync(s *step, start func(ctx context.Context, done func([]interface{}, error))) *Future {
+	stepFtr := newFuture(s.ctx)
+	stepFtr.es = fl.es
+	stepFtr.trigger = func() {
+		defer func() {
+			if r := recover(); r != nil {
+				stepFtr.settle(nil, newPanicError(r))
+			}
+		}()
+		start(stepFtr.ctx, func(values []interface{}, err error) {
+			if ctxErr := stepFtr.ctx.Err(); ctxErr != nil {
+				stepFtr.finish(stepFtr.ctxStage(ctxErr), nil, ctxErr)
+				return
+			}
+			stepFtr.settle(values, err)
+		})
+	}
+	atomic.StoreInt32(&s.attempts, 1)
+	return stepFtr
+}
+
+// attempt calls the target function of the step once more, a failed attempt is retried after the backoff
+// as long as the retry policy allows it.
+func (fl *Flow) attempt(i int, stepFtr *Future, args []interface{}) {
+	s := fl.steps[i]
+	attempt := int(atomic.AddInt32(&s.attempts, 1))
+	attemptFtr, _ := RunAsyncCtx(stepFtr.ctx, s.targetFunc, args...)
+	attemptFtr.SetExecutor(fl.es)
+	attemptFtr.detached = true
+	if s.compensate != nil {
+		attemptFtr.around = fl.guard(i)
+	}
+	attemptFtr.whenDone(func() {
+		err := attemptFtr.err
+		if err == nil {
+			_, err = splitError(s.targetFunc, attemptFtr.funcReturned)
+		}
+		if err == nil || attemptFtr.Stage() != COMPLETED || !s.retry.retries(attempt, err) {
+			stepFtr.adopt(attemptFtr)
+			return
 		}
+		time.AfterFunc(s.retry.delay(attempt), func() {
+			if err := stepFtr.ctx.Err(); err != nil {
+				stepFtr.finish(stepFtr.ctxStage(err), nil, err)
+				return
+			}
+			fl.attempt(i, stepFtr, args)
+		})
+	})
+	attemptFtr.Execute()
+}
 
+// stepOutput returns the values the i'th step, which is done, passes on to the steps depending on it.
+// A trailing error returned by the target function is not passed on, the step fails if it is not nil.
+// The flow is not short-circuited by this method, as the failure may be handled by a RECOVER step.
+func (fl *Flow) stepOutput(i int) ([]interface{}, error) {
+	s := fl.steps[i]
+	get, err := s.future.Get(0)
+	if errors.Is(err, context.DeadlineExceeded) && (s.timeout > 0 || fl.budget > 0) {
+		err = ErrStepTimeout
+	}
+	values := get
+	if err == nil && s.returnsTarget() {
+		values, err = splitError(s.targetFunc, get)
 	}
+	if err != nil && s.onError != nil && fl.ctx.Err() == nil {
+		values, err = fallback(s.ctx, s.onError, err)
+	}
+	if err != nil {
+		return nil, fl.stepError(i, err)
+	}
+	return values, nil
+}
 
-	var (
-		flowReturn []interface{}
-		flowError  error = fmt.Errorf("flow aborted/timedout")
-	)
-	if fl.steps[len(fl.steps)-1].future != nil { //this is to check for aborts/timeout
-		flowReturn, flowError = fl.steps[len(fl.steps)-1].future.Get(0)
+// stepFailed short-circuits the flow, cancelling the steps that are still pending or running.
+func (fl *Flow) stepFailed(i int, err error) error {
+	fl.cancelSteps(i)
+	return fl.stepError(i, err)
+}
+
+func (fl *Flow) stepError(i int, err error) *StepError {
+	return &StepError{
+		Index:    i,
+		Name:     funcName(fl.steps[i].targetFunc),
+		Step:     fl.steps[i].name,
+		Op:       fl.steps[i].op,
+		Attempts: int(atomic.LoadInt32(&fl.steps[i].attempts)),
+		Err:      err,
 	}
-	fmt.Println("completed flow")
-	return flowReturn, flowError
 }
 
 // This has to be called to trigger the execution of steps/pipeline represented by this flow.
 // The target function(s) will not be executed unless this method is invoked.
 // Each target function in the flow is executed by a separate GOROUTINE either parallelly or one after another
 func (fl *Flow) Execute() *Flow {
+	return fl.ExecuteWith(nil)
+}
+
+// ExecuteWith is same as Execute(), the placeholders passed to the steps, see Input(), are resolved from the inputs.
+// Get() returns an error if an input is not supplied or does not match the parameter of the target function.
+func (fl *Flow) ExecuteWith(inputs Inputs) *Flow {
 	fl.runOnce.Do(func() {
-		if flowFtr, err := RunAsync(fl.runFlow); err != nil {
-			fmt.Errorf("error (%s) while creating future", err.Error())
-		} else {
-			fl.future = flowFtr
-			flowFtr.SetExecutor(fl.es).Execute()
+		if fl.budget > 0 {
+			fl.deadline = time.Now().Add(fl.budget)
+		}
+		fl.inputs = inputs
+		err := fl.resolveInputs()
+		if err == nil {
+			err = fl.Validate()
+		}
+		var flowFtr *Future
+		if err == nil {
+			flowFtr = newFuture(fl.ctx)
+			flowFtr.trigger = func() {
+				fl.runFlow(flowFtr)
+			}
+		}
+
+		fl.mu.Lock()
+		fl.err = err
+		fl.future = flowFtr
+		fl.compensated = make(chan struct{})
+		if flowFtr == nil {
+			close(fl.compensated)
+		}
+		fl.mu.Unlock()
+		if flowFtr != nil {
+			flowFtr.SetExecutor(fl.es)
+			flowFtr.whenDone(func() {
+				fl.mu.Lock()
+				if !fl.running {
+					close(fl.compensated) //runFlow() is not called once the flow is done
+				}
+				fl.mu.Unlock()
+				fl.cancelCtx() //releases the ctx of the flow, which may be derived from a long lived ctx
+				_, err := fl.result(flowFtr.funcReturned, flowFtr.err)
+				fl.runFinally(err)
+			})
+			flowFtr.Execute()
+		} else if len(fl.finally) > 0 {
+			fl.es.submitCallback(func() {
+				fl.runFinally(err)
+			})
 		}
 	})
 	return fl
 }
 
+// runFinally calls the functions registered by Finally(), a panic is reported to the panic handler of the executor.
+func (fl *Flow) runFinally(err error) {
+	for _, fn := range fl.finally {
+		var args []interface{}
+		if reflect.TypeOf(fn).NumIn() == 1 {
+			args = append(args, err)
+		}
+		if _, e := invoke(fl.stateCtx(), fn, args); e != nil {
+			if panicErr, ok := e.(*PanicError); ok {
+				fl.es.handlePanic(panicErr)
+			}
+		}
+	}
+}
+
 // Call to Get() blocks until the target function(s) invocation is completed.
 // Return from this method indicates successful execution of target function(s) or time-out or user aborted/cancelled this flow.
 // error is returned in case of timeouts or aborted.
-// This method always returns results of the last target function of the flow
+// This method always returns the values passed on by the last step of the flow, i.e. the results of its target function
+// without the trailing error or the values returned by its OnError() handler, see Results() for the other steps
 func (fl *Flow) Get(timeout time.Duration) ([]interface{}, error) {
-	if fl.future == nil {
-		return nil, fmt.Errorf("future not created for the flow")
+	flowFtr, err := fl.flowFuture()
+	if err != nil {
+		return nil, err
 	}
 	if timeout > 0 {
-		time.AfterFunc(timeout, func() {
-			for _, s := range fl.steps {
-				if s.future != nil && s.future.Stage() != COMPLETED {
-					fmt.Errorf("Timeout (%d) got triggered hence cancelling target (%+v)", timeout, reflect.TypeOf(s.targetFunc))
-					s.future.Cancel()
-				}
-			}
+		tmr := time.AfterFunc(timeout, func() {
+			flowFtr.finish(TIMEDOUT, nil, ErrTimedOut) //before the ctx is cancelled, which would abort the flow instead
+			fl.cancelCtx()
+			fl.cancelSteps(-1)
 		})
+		defer tmr.Stop()
+	}
+	return fl.result(flowFtr.Get(timeout))
+}
+
+// GetCtx is same as Get() but waits until the ctx is done instead of a timeout.
+// The flow is cancelled if the ctx is done before the target function(s) invocation is completed.
+func (fl *Flow) GetCtx(ctx context.Context) ([]interface{}, error) {
+	flowFtr, err := fl.flowFuture()
+	if err != nil {
+		return nil, err
+	}
+	get, e := flowFtr.GetCtx(ctx)
+	if ctx.Err() != nil {
+		fl.Cancel()
+	}
+	return fl.result(get, e)
+}
+
+// CompensationErr waits for the compensations called after the flow failed, was cancelled or timedout, see WithCompensation().
+// It returns an *AggregateError of the compensations that failed, nil if none failed or the flow completed.
+// ErrTimedOut is returned if they are not done in time, a timeout <= 0 waits until they are done.
+func (fl *Flow) CompensationErr(timeout time.Duration) error {
+	fl.mu.Lock()
+	compensated := fl.compensated
+	fl.mu.Unlock()
+	if compensated == nil {
+		return fmt.Errorf("flow is not executed")
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		tmr := time.NewTimer(timeout)
+		defer tmr.Stop()
+		expired = tmr.C
+	}
+	select {
+	case <-compensated:
+	case <-expired:
+		return ErrTimedOut
+	}
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	return fl.compensationErr
+}
+
+func (fl *Flow) flowFuture() (*Future, error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	if fl.err != nil {
+		return nil, fl.err
 	}
-	if get, e := fl.future.Get(timeout); e != nil {
+	if fl.future == nil {
+		return nil, fmt.Errorf("future not created for the flow")
+	}
+	return fl.future, nil
+}
+
+func (fl *Flow) result(get []interface{}, e error) ([]interface{}, error) {
+	if e != nil {
 		return nil, e
-	} else {
-		if get[1] != nil {
-			return nil, get[1].(error)
-		}
-		return get[0].([]interface{}), nil
 	}
+	if get[1] != nil {
+		return nil, get[1].(error)
+	}
+	return get[0].([]interface{}), nil
 }
 
 // Cancel's the referred flow, sends a signal to abort the call of all the referred target function(s).
 // This method returns immediately.
-// Call to Cancel() does not mean the target function(s) is aborted if it is running already.
+// Call to Cancel() does not mean the target function(s) is aborted if it is running already,
+// unless the target function accepts a context.Context as its first parameter, which is cancelled.
 // Target function(s) will not be called if it is not triggered yet when Cancel() is called.
 // Any call to *Flow.Get() after Cancel() is invoked will return an error indicating aborted
 func (fl *Flow) Cancel() {
-	if fl.future == nil {
+	flowFtr, err := fl.flowFuture()
+	if err != nil {
 		return
 	}
-	fl.future.Cancel()
-	for _, s := range fl.steps {
-		if s.future != nil {
-			s.future.Cancel()
+	fl.cancelCtx()
+	flowFtr.Cancel()
+	fl.cancelSteps(-1)
+}
+
+// cancelStep cancels the future of the i'th step, if it is submitted.
+func (fl *Flow) cancelStep(i int) {
+	fl.mu.Lock()
+	stepFtr := fl.steps[i].future
+	fl.mu.Unlock()
+	if stepFtr != nil {
+		stepFtr.Cancel()
+	}
+}
+
+// cancelSteps cancels the futures of all the steps submitted so far, except the step at index except.
+func (fl *Flow) cancelSteps(except int) {
+	fl.mu.Lock()
+	var stepFtrs []*Future
+	for i, s := range fl.steps {
+		if i != except && s.future != nil {
+			stepFtrs = append(stepFtrs, s.future)
 		}
 	}
+	fl.mu.Unlock()
+
+	for _, stepFtr := range stepFtrs {
+		stepFtr.Cancel()
+	}
+}
+
+// splitError separates the trailing error returned by the target function from the rest of the values returned.
+func splitError(targetFunc interface{}, returned []interface{}) ([]interface{}, error) {
+	targetType := reflect.TypeOf(targetFunc)
+	if targetType == nil || targetType.NumOut() == 0 || targetType.Out(targetType.NumOut()-1) != errorType || len(returned) == 0 {
+		return returned, nil
+	}
+	last := len(returned) - 1
+	if err, ok := returned[last].(error); ok && err != nil {
+		return nil, err
+	}
+	return returned[:last], nil
+}
+
+func funcName(targetFunc interface{}) string {
+	if targetFunc == nil {
+		return "<future>"
+	}
+	if reflect.TypeOf(targetFunc).Kind() != reflect.Func {
+		return reflect.TypeOf(targetFunc).String()
+	}
+	if fn := runtime.FuncForPC(reflect.ValueOf(targetFunc).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return reflect.TypeOf(targetFunc).String()
 }
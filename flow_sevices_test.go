@@ -1,25 +1,30 @@
 package workflow
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func TestFlow_AndCall(t *testing.T) {
 
-	counter := 2
+	counter := int32(2)
 	flow := NewFlow(func() {
-		counter = counter - 1
+		atomic.AddInt32(&counter, -1)
 	}).AndCall(func() {
 		time.Sleep(50 * time.Millisecond)
-		counter = counter - 1
+		atomic.AddInt32(&counter, -1)
 	})
 	flow.Execute()
 	flow.Get(0)
 
-	if counter != 0 {
-		t.Errorf("expected counter=0 but counter=%d", counter)
+	if left := atomic.LoadInt32(&counter); left != 0 {
+		t.Errorf("expected counter=0 but counter=%d", left)
 	}
 }
 
@@ -92,10 +97,27 @@ func TestFlow_Get_TimeOut(t *testing.T) {
 
 }
 
+func TestFlow_Get_TimeOut_Stage(t *testing.T) {
+	for round := 0; round < 100; round++ {
+		flow := NewFlow(func(ctx context.Context) bool {
+			<-ctx.Done()
+			return false
+		})
+
+		flow.Execute()
+		if _, err := flow.Get(time.Millisecond); !errors.Is(err, ErrTimedOut) {
+			t.Fatalf("expected ErrTimedOut but got %v", err)
+		}
+		if _, err := flow.Get(0); !errors.Is(err, ErrTimedOut) {
+			t.Fatalf("expected ErrTimedOut to be returned again but got %v", err)
+		}
+	}
+}
+
 func TestFlow_Execute_RunOnce(t *testing.T) {
-	counter := 1
+	counter := int32(1)
 	flow := NewFlow(func() {
-		counter = counter - 1
+		atomic.AddInt32(&counter, -1)
 	})
 
 	go func() {
@@ -106,8 +128,913 @@ func TestFlow_Execute_RunOnce(t *testing.T) {
 	}()
 
 	flow.Get(0)
-	if counter < 0 {
-		t.Errorf("target func ran twice!!, expected counter=0 but it is set to %d", counter)
+	if ran := atomic.LoadInt32(&counter); ran < 0 {
+		t.Errorf("target func ran twice!!, expected counter=0 but it is set to %d", ran)
+	}
+}
+
+func TestFlow_Get_Panic(t *testing.T) {
+	flow := NewFlow(func() int {
+		return 1
+	}).ThenApply(func(cnt int) int {
+		panic("boom")
+	})
+
+	flow.Execute()
+	var panicErr *PanicError
+	if _, err := flow.Get(0); !errors.As(err, &panicErr) {
+		t.Errorf("expected a PanicError but got %v", err)
+	}
+}
+
+func TestFlow_Cancel_StopsContextTarget(t *testing.T) {
+	stopped := make(chan error, 1)
+	flow := NewFlow(func() int {
+		return 1
+	}).ThenApply(func(ctx context.Context, cnt int) int {
+		select {
+		case <-ctx.Done():
+			stopped <- ctx.Err()
+		case <-time.After(time.Second):
+			stopped <- nil
+		}
+		return cnt
+	})
+
+	flow.Execute()
+	time.AfterFunc(20*time.Millisecond, flow.Cancel)
+	if _, err := flow.Get(0); err == nil {
+		t.Errorf("expected an error!!!")
+	}
+	select {
+	case err := <-stopped:
+		if err != context.Canceled {
+			t.Errorf("expected the target to be cancelled but got %v", err)
+		}
+	case <-time.After(1500 * time.Millisecond): //target was cancelled before it started
+	}
+}
+
+func TestFlow_GetCtx_Deadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	flow := NewFlowCtx(ctx, func(ctx context.Context) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(100 * time.Millisecond):
+			return true
+		}
+	})
+
+	flow.Execute()
+	if _, err := flow.GetCtx(ctx); err == nil {
+		t.Errorf("expected an error!!!")
+	}
+}
+
+func TestFlow_ThenApply_ErrorReturnNotPassed(t *testing.T) {
+	flow := NewFlow(func() (int, error) {
+		return 2, nil
+	}).ThenApply(func(cnt int) int {
+		return cnt * 2
+	})
+
+	flow.Execute()
+	if get, err := flow.Get(0); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	} else if len(get) != 1 || get[0] != 4 {
+		t.Errorf("expected a return value of 4 but got %v", get)
+	}
+}
+
+func TestFlow_Get_StepError(t *testing.T) {
+	failed := errors.New("failed")
+	siblingStopped := make(chan bool, 1)
+	applied := false
+	flow := NewFlow(func() (int, error) {
+		return 0, failed
+	}).AndCall(func(ctx context.Context) int {
+		select {
+		case <-ctx.Done():
+			siblingStopped <- true
+		case <-time.After(time.Second):
+			siblingStopped <- false
+		}
+		return 1
+	}).ThenCombine(func(op1, op2 int) int {
+		applied = true
+		return op1 + op2
+	})
+
+	flow.Execute()
+	_, err := flow.Get(0)
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) {
+		t.Fatalf("expected a StepError but got %v", err)
+	}
+	if stepErr.Index != 0 || stepErr.Op != CALL || stepErr.Err != failed || stepErr.Name == "" {
+		t.Errorf("expected step 0 (CALL) to fail with %v but got %+v", failed, stepErr)
+	}
+	if !errors.Is(err, failed) {
+		t.Errorf("expected the error returned by the step to be wrapped")
+	}
+	select {
+	case stopped := <-siblingStopped:
+		if !stopped {
+			t.Errorf("expected the sibling step to be cancelled")
+		}
+	case <-time.After(1500 * time.Millisecond): //sibling step was cancelled before it started
+	}
+	if applied {
+		t.Errorf("did not expect the combine step to be called")
+	}
+}
+
+func TestFlow_WithRetry(t *testing.T) {
+	calls := int32(0)
+	transient := errors.New("transient")
+	flow := NewFlow(func() (int, error) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return 0, transient
+		}
+		return 10, nil
+	}).WithRetry(3, ConstantBackoff(5*time.Millisecond), nil).
+		ThenApply(func(amount int) int {
+			return amount * 2
+		})
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil {
+		t.Errorf("expected the step to succeed on the third attempt but got %v", err)
+	} else if get[0] != 20 {
+		t.Errorf("expected 20 but got %v", get[0])
+	}
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("expected 3 calls but got %d", calls)
+	}
+}
+
+func TestFlow_WithRetry_Exhausted(t *testing.T) {
+	calls := int32(0)
+	flow := NewFlow(func() int {
+		atomic.AddInt32(&calls, 1)
+		panic("unavailable")
+	}).WithRetry(2, ExponentialBackoff(time.Millisecond, 10*time.Millisecond), nil)
+
+	flow.Execute()
+	_, err := flow.Get(time.Second)
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) {
+		t.Fatalf("expected a StepError but got %v", err)
+	}
+	if stepErr.Attempts != 2 || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("expected 2 attempts but got %d (calls %d)", stepErr.Attempts, calls)
+	}
+}
+
+func TestFlow_WithRetry_NotRetryable(t *testing.T) {
+	calls := int32(0)
+	permanent := errors.New("permanent")
+	flow := NewFlow(func() error {
+		atomic.AddInt32(&calls, 1)
+		return permanent
+	}).WithRetry(5, nil, func(err error) bool {
+		return err != permanent
+	})
+
+	flow.Execute()
+	if _, err := flow.Get(time.Second); !errors.Is(err, permanent) {
+		t.Errorf("expected %v but got %v", permanent, err)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("expected a single call for an error that is not retryable but got %d", calls)
+	}
+}
+
+func TestFlow_WithRetry_Invalid(t *testing.T) {
+	flow := NewFlow(func() int { return 1 }).WithRetry(0, nil, nil)
+	if err := flow.Validate(); err == nil {
+		t.Errorf("expected an error for max attempts < 1")
+	}
+	flow = NewFlowFromFuture(NewPromise().Future()).WithRetry(2, nil, nil)
+	if err := flow.Validate(); err == nil {
+		t.Errorf("expected an error for retrying a step awaiting a future")
+	}
+}
+
+func TestFlow_WithStepTimeout(t *testing.T) {
+	flow := NewFlow(func() int {
+		return 1
+	}).AndCall(func(ctx context.Context) int {
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+		return 2
+	}).WithStepTimeout(50 * time.Millisecond).
+		ThenCombine(func(op1, op2 int) int {
+			return op1 + op2
+		})
+
+	start := time.Now()
+	flow.Execute()
+	_, err := flow.Get(0)
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) {
+		t.Fatalf("expected a StepError but got %v", err)
+	}
+	if stepErr.Index != 1 || !errors.Is(err, ErrStepTimeout) {
+		t.Errorf("expected step 1 to fail with %v but got %v", ErrStepTimeout, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the step to time out after 50ms but it took %v", elapsed)
+	}
+	if result := flow.Results()[1]; result.Stage != TIMEDOUT || !errors.Is(result.Err, ErrStepTimeout) {
+		t.Errorf("expected step 1 to be TIMEDOUT with %v but got %+v", ErrStepTimeout, result)
+	}
+}
+
+func TestFlow_WithStepTimeout_InTime(t *testing.T) {
+	flow := NewFlow(func() int {
+		time.Sleep(10 * time.Millisecond)
+		return 1
+	}).WithStepTimeout(time.Second)
+
+	flow.Execute()
+	if get, err := flow.Get(0); err != nil || get[0] != 1 {
+		t.Errorf("expected 1 but got %v, %v", get, err)
+	}
+}
+
+func TestFlow_WithBudget(t *testing.T) {
+	hasDeadline := make(chan bool, 1)
+	flow := NewFlow(func() int {
+		time.Sleep(30 * time.Millisecond)
+		return 1
+	}).ThenApply(func(ctx context.Context, n int) int {
+		_, ok := ctx.Deadline()
+		hasDeadline <- ok
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+		return n
+	}).WithBudget(100 * time.Millisecond)
+
+	flow.Execute()
+	_, err := flow.Get(0)
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Index != 1 || !errors.Is(err, ErrStepTimeout) {
+		t.Errorf("expected step 1 to fail with %v but got %v", ErrStepTimeout, err)
+	}
+	if !<-hasDeadline {
+		t.Errorf("expected the budget to be propagated as the deadline of the context")
+	}
+}
+
+func TestFlow_DependsOn(t *testing.T) {
+	flow := NewFlow(func() int {
+		time.Sleep(100 * time.Millisecond)
+		return 100
+	}).Named("bill").
+		Step("rate", func() int {
+			time.Sleep(100 * time.Millisecond)
+			return 60
+		}).
+		Step("tax", func(percent, bill, rate int) int {
+			return bill * rate * percent / 100
+		}, 10).DependsOn("bill", "rate")
+
+	start := time.Now()
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil {
+		t.Errorf("expected no error but got %v", err)
+	} else if get[0] != 600 {
+		t.Errorf("expected 600 but got %v", get[0])
+	}
+	if elapsed := time.Since(start); elapsed > 180*time.Millisecond {
+		t.Errorf("expected bill and rate to run in parallel but the flow took %v", elapsed)
+	}
+}
+
+func TestFlow_DependsOn_StartsWhenReady(t *testing.T) {
+	slowDone := int32(0)
+	startedEarly := int32(0)
+	flow := NewFlow(func() int {
+		time.Sleep(100 * time.Millisecond)
+		atomic.StoreInt32(&slowDone, 1)
+		return 1
+	}).Named("slow").
+		Step("fast", func() int {
+			return 2
+		}).
+		Step("afterFast", func(n int) int {
+			if atomic.LoadInt32(&slowDone) == 0 {
+				atomic.StoreInt32(&startedEarly, 1)
+			}
+			return n * 10
+		}).DependsOn("fast").
+		ThenCombine(func(slow, afterFast int) int {
+			return slow + afterFast
+		}).DependsOn("slow", "afterFast")
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != 21 {
+		t.Errorf("expected 21 but got %v, %v", get, err)
+	}
+	if atomic.LoadInt32(&startedEarly) != 1 {
+		t.Errorf("expected afterFast to start without waiting for the slow step")
+	}
+}
+
+func TestFlow_DependsOn_DeclaredLater(t *testing.T) {
+	flow := NewFlow(func(a, b int) int {
+		return a + b
+	}).Named("sum").DependsOn("a", "b").
+		Step("a", func() int { return 1 }).
+		Step("b", func() int { return 2 }).
+		ThenApply(func(n int) int { return n * 2 }).DependsOn("sum")
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != 6 {
+		t.Errorf("expected 6 but got %v, %v", get, err)
+	}
+}
+
+func TestFlow_DependsOn_Invalid(t *testing.T) {
+	unknown := NewFlow(func(int) int { return 1 }).DependsOn("missing")
+	if err := unknown.Validate(); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("expected an error for an unknown step but got %v", err)
+	}
+
+	cycle := NewFlow(func(int) int { return 1 }).Named("a").DependsOn("b").
+		Step("b", func(int) int { return 2 }).DependsOn("a")
+	if err := cycle.Validate(); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected an error for a cycle but got %v", err)
+	}
+
+	duplicate := NewFlow(func() int { return 1 }).Named("a").Step("a", func() int { return 2 })
+	var stepErr *StepError
+	if err := duplicate.Validate(); !errors.As(err, &stepErr) || stepErr.Index != 1 {
+		t.Errorf("expected an error for step 1 reusing a name but got %v", err)
+	}
+
+	mismatch := NewFlow(func() string { return "1" }).Named("a").Step("b", func(int) int { return 2 }).DependsOn("a")
+	if err := mismatch.Validate(); !errors.As(err, &stepErr) || stepErr.Step != "b" {
+		t.Errorf("expected step b to be reported but got %v", err)
+	}
+}
+
+func TestFlow_ThenReduce(t *testing.T) {
+	slowDone := int32(0)
+	foldedEarly := int32(0)
+	flow := NewFlow(func() int {
+		return 1
+	}).AndCall(func() int {
+		time.Sleep(50 * time.Millisecond)
+		atomic.StoreInt32(&slowDone, 1)
+		return 2
+	}).AndCall(func() (int, error) {
+		return 3, nil
+	}).ThenReduce(0, func(sum, n int) int {
+		if atomic.LoadInt32(&slowDone) == 0 {
+			atomic.StoreInt32(&foldedEarly, 1)
+		}
+		return sum + n
+	}).ThenApply(func(sum int) string {
+		return fmt.Sprintf("sum %d", sum)
+	})
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != "sum 6" {
+		t.Errorf("expected 'sum 6' but got %v, %v", get, err)
+	}
+	if atomic.LoadInt32(&foldedEarly) != 1 {
+		t.Errorf("expected the results of the fast steps to be folded before the slow step completes")
+	}
+}
+
+func TestFlow_ThenReduce_AfterMap(t *testing.T) {
+	flow := NewFlow(func() []int {
+		return []int{1, 2, 3}
+	}).ThenMap(func(n int) int {
+		return n * n
+	}, 2).ThenReduce(0, func(sum, square int) int {
+		return sum + square
+	})
+
+	if len(flow.steps) != 2 {
+		t.Errorf("expected the reducer to be applied by the MAP step but the flow has %d steps", len(flow.steps))
+	}
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != 14 {
+		t.Errorf("expected 14 but got %v, %v", get, err)
+	}
+}
+
+type wordCounter struct {
+	counts map[string]int
+}
+
+func (w *wordCounter) Add(values ...interface{}) error {
+	for _, value := range values {
+		w.counts[value.(string)]++
+	}
+	return nil
+}
+
+func (w *wordCounter) Result() interface{} {
+	return w.counts
+}
+
+func TestFlow_ThenCollect(t *testing.T) {
+	flow := NewFlow(func() string {
+		return "go"
+	}).AndCall(func() string {
+		return "flow"
+	}).AndCall(func() string {
+		return "go"
+	}).ThenCollect(func() Collector {
+		return &wordCounter{counts: map[string]int{}}
+	})
+
+	flow.Execute()
+	get, err := flow.Get(time.Second)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if counts := get[0].(map[string]int); counts["go"] != 2 || counts["flow"] != 1 {
+		t.Errorf("expected go=2 and flow=1 but got %v", counts)
+	}
+}
+
+func TestFlow_ThenReduce_ReducerFails(t *testing.T) {
+	reducerFailed := errors.New("reducer failed")
+	sum := func() *Flow {
+		return NewFlow(func() int {
+			return 1
+		}).AndCall(func() int {
+			return 2
+		}).ThenReduce(0, func(sum, n int) (int, error) {
+			if n == 2 {
+				return 0, reducerFailed
+			}
+			return sum + n, nil
+		})
+	}
+
+	failed := sum()
+	failed.Execute()
+	var stepErr *StepError
+	if _, err := failed.Get(time.Second); !errors.As(err, &stepErr) || stepErr.Op != REDUCE || !errors.Is(err, reducerFailed) {
+		t.Errorf("expected the REDUCE step to fail with %v but got %v", reducerFailed, err)
+	}
+	if result := failed.Results()[2]; result.Stage != COMPLETED || !errors.Is(result.Err, reducerFailed) {
+		t.Errorf("expected the result of the REDUCE step to hold %v but got %v, %v", reducerFailed, result.Stage, result.Err)
+	}
+
+	handled := sum().OnError(func(err error) int {
+		return -1
+	}).ThenApply(func(sum int) int {
+		return sum
+	})
+	handled.Execute()
+	if get, err := handled.Get(time.Second); err != nil || get[0] != -1 {
+		t.Errorf("expected -1 from the error handler of the REDUCE step but got %v, %v", get, err)
+	}
+
+	recovered := sum().Recover(func(err error) int {
+		return -2
+	})
+	recovered.Execute()
+	if get, err := recovered.Get(time.Second); err != nil || get[0] != -2 {
+		t.Errorf("expected -2 from the RECOVER step but got %v, %v", get, err)
+	}
+}
+
+func TestFlow_ThenReduce_Validate(t *testing.T) {
+	mismatch := NewFlow(func() string { return "1" }).ThenReduce(0, func(sum, n int) int { return sum + n })
+	var stepErr *StepError
+	if err := mismatch.Validate(); !errors.As(err, &stepErr) || stepErr.Op != REDUCE {
+		t.Errorf("expected the REDUCE step to be reported but got %v", err)
+	}
+
+	initial := NewFlow(func() int { return 1 }).ThenReduce("0", func(sum, n int) int { return sum + n })
+	if err := initial.Validate(); err == nil {
+		t.Errorf("expected an error for an initial value not accepted by the reducer")
+	}
+}
+
+func TestFlow_OnError_LastStep(t *testing.T) {
+	flow := NewFlow(func() (int, error) {
+		return 0, errors.New("x")
+	}).OnError(func(error) int {
+		return 42
+	})
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || len(get) != 1 || get[0] != 42 {
+		t.Errorf("expected [42] from the error handler of the last step but got %v, %v", get, err)
+	}
+
+	panicking := NewFlow(func() int {
+		panic("x")
+	}).OnError(func(err error) int {
+		var panicErr *PanicError
+		if !errors.As(err, &panicErr) {
+			return -1
+		}
+		return 42
+	})
+	panicking.Execute()
+	if get, err := panicking.Get(time.Second); err != nil || len(get) != 1 || get[0] != 42 {
+		t.Errorf("expected [42] from the error handler of the panicking last step but got %v, %v", get, err)
+	}
+
+	unhandled := NewFlow(func() int {
+		panic("x")
+	})
+	unhandled.Execute()
+	var panicErr *PanicError
+	if get, err := unhandled.Get(time.Second); !errors.As(err, &panicErr) {
+		t.Errorf("expected the panic of the last step to fail the flow but got %v, %v", get, err)
+	}
+
+	trailing := NewFlow(func() (int, error) {
+		return 5, nil
+	})
+	trailing.Execute()
+	if get, err := trailing.Get(time.Second); err != nil || len(get) != 1 || get[0] != 5 {
+		t.Errorf("expected [5] without the trailing error but got %v, %v", get, err)
+	}
+}
+
+func TestFlow_OnError(t *testing.T) {
+	unavailable := errors.New("unavailable")
+	flow := NewFlow(func() (int, error) {
+		return 0, unavailable
+	}).OnError(func(err error) int {
+		if !errors.Is(err, unavailable) {
+			return -1
+		}
+		return 60
+	}).ThenApply(func(rate int) int {
+		return rate * 100
+	})
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != 6000 {
+		t.Errorf("expected the fallback rate to be used but got %v, %v", get, err)
+	}
+}
+
+func TestFlow_OnError_HandlerFails(t *testing.T) {
+	unavailable := errors.New("unavailable")
+	flow := NewFlow(func() (int, error) {
+		return 0, errors.New("failed")
+	}).OnError(func(err error) (int, error) {
+		return 0, unavailable
+	})
+
+	flow.Execute()
+	var stepErr *StepError
+	if _, err := flow.Get(time.Second); !errors.As(err, &stepErr) || !errors.Is(err, unavailable) {
+		t.Errorf("expected the step to fail with the error of the handler but got %v", err)
+	}
+}
+
+func TestFlow_OnFlowError(t *testing.T) {
+	flow := NewFlow(func() int {
+		return 1
+	}).ThenApply(func(int) (string, error) {
+		return "", errors.New("failed")
+	}).OnFlowError(func(err error) string {
+		var stepErr *StepError
+		if errors.As(err, &stepErr) {
+			return fmt.Sprintf("fallback for step %d", stepErr.Index)
+		}
+		return "fallback"
+	})
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != "fallback for step 1" {
+		t.Errorf("expected the fallback of the flow but got %v, %v", get, err)
+	}
+}
+
+func TestFlow_Recover(t *testing.T) {
+	skipped := int32(0)
+	flow := NewFlow(func() (int, error) {
+		return 0, errors.New("failed")
+	}).ThenApply(func(n int) int {
+		atomic.AddInt32(&skipped, 1)
+		return n + 1
+	}).Recover(func(err error) int {
+		return -1
+	}).ThenApply(func(n int) string {
+		return fmt.Sprintf("got %d", n)
+	})
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != "got -1" {
+		t.Errorf("expected the recovered value but got %v, %v", get, err)
+	}
+	if atomic.LoadInt32(&skipped) != 0 {
+		t.Errorf("did not expect the step after the failed step to run")
+	}
+}
+
+func TestFlow_Recover_PassesResults(t *testing.T) {
+	flow := NewFlow(func() (int, error) {
+		return 1, nil
+	}).ThenApply(func(n int) int {
+		return n + 1
+	}).Recover(func(err error) int {
+		return -1
+	}).ThenApply(func(n int) string {
+		return fmt.Sprintf("got %d", n)
+	})
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != "got 2" {
+		t.Errorf("expected the results to be passed on but got %v, %v", get, err)
+	}
+}
+
+func TestFlow_Recover_ManyFailures(t *testing.T) {
+	recovered := int32(0)
+	flow := NewFlow(func() (int, error) {
+		return 0, errors.New("a failed")
+	}).AndCall(func() (int, error) {
+		time.Sleep(100 * time.Millisecond) //fails after the RECOVER step handled the failure of the first step
+		return 0, errors.New("b failed")
+	}).ThenCombine(func(a, b int) int {
+		return a + b
+	}).Recover(func(err error) int {
+		atomic.AddInt32(&recovered, 1)
+		return -1
+	})
+
+	flow.Execute()
+	if get, err := flow.Get(2 * time.Second); err != nil || get[0] != -1 {
+		t.Errorf("expected the recovered value but got %v, %v", get, err)
+	}
+	if n := atomic.LoadInt32(&recovered); n != 1 {
+		t.Errorf("expected the handler to be called once but got %d", n)
+	}
+}
+
+func TestFlow_Recover_Validate(t *testing.T) {
+	mismatch := NewFlow(func() int { return 1 }).Recover(func(err error) string { return "" })
+	var stepErr *StepError
+	if err := mismatch.Validate(); !errors.As(err, &stepErr) || stepErr.Op != RECOVER {
+		t.Errorf("expected the RECOVER step to be reported but got %v", err)
+	}
+
+	notHandler := NewFlow(func() int { return 1 }).Recover(func(n int) int { return n })
+	if err := notHandler.Validate(); err == nil {
+		t.Errorf("expected an error for a handler not accepting an error")
+	}
+
+	onError := NewFlow(func() int { return 1 }).OnError(func(err error) string { return "" })
+	if err := onError.Validate(); err == nil {
+		t.Errorf("expected an error for a handler not returning the results of the step")
+	}
+}
+
+func TestFlow_Finally(t *testing.T) {
+	failed := errors.New("failed")
+	finally := make(chan error, 1)
+	flow := NewFlow(func() (int, error) {
+		return 0, failed
+	}).Finally(func(err error) {
+		finally <- err
+	})
+
+	flow.Execute()
+	_, err := flow.Get(time.Second)
+	select {
+	case finallyErr := <-finally:
+		if finallyErr != err || !errors.Is(finallyErr, failed) {
+			t.Errorf("expected finally to be passed %v but got %v", err, finallyErr)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected finally to be called")
+	}
+}
+
+func TestFlow_Finally_Cancel(t *testing.T) {
+	finally := make(chan struct{})
+	flow := NewFlow(func(ctx context.Context) int {
+		<-ctx.Done()
+		return 1
+	}).Finally(func() {
+		close(finally)
+	})
+
+	flow.Execute()
+	time.Sleep(10 * time.Millisecond)
+	flow.Cancel()
+	select {
+	case <-finally:
+	case <-time.After(time.Second):
+		t.Errorf("expected finally to be called after the flow is cancelled")
+	}
+}
+
+func TestFlow_WithCompensation(t *testing.T) {
+	failed := errors.New("out of stock")
+	var undone []string
+	var mu sync.Mutex
+	undo := func(what string) {
+		mu.Lock()
+		defer mu.Unlock()
+		undone = append(undone, what)
+	}
+	flow := NewFlow(func() string {
+		return "payment"
+	}).WithCompensation(func(payment string) {
+		undo("refund " + payment)
+	}).ThenApply(func(payment string) string {
+		return "reservation"
+	}).WithCompensation(func(reservation string) {
+		undo("release " + reservation)
+	}).ThenApply(func(string) (string, error) {
+		return "", failed
+	}).WithCompensation(func(string) {
+		undo("not completed")
+	})
+
+	flow.Execute()
+	if _, err := flow.Get(time.Second); !errors.Is(err, failed) {
+		t.Errorf("expected the flow to fail with %v but got %v", failed, err)
+	}
+	if err := flow.CompensationErr(time.Second); err != nil {
+		t.Errorf("expected no compensation error but got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if expected := []string{"release reservation", "refund payment"}; fmt.Sprint(undone) != fmt.Sprint(expected) {
+		t.Errorf("expected compensations %v in the reverse order but got %v", expected, undone)
+	}
+}
+
+func TestFlow_WithCompensation_Fails(t *testing.T) {
+	failed := errors.New("failed")
+	refundFailed := errors.New("refund failed")
+	flow := NewFlow(func() int {
+		return 100
+	}).WithCompensation(func(amount int) error {
+		return refundFailed
+	}).ThenApply(func(int) (int, error) {
+		return 0, failed
+	})
+
+	flow.Execute()
+	if _, err := flow.Get(time.Second); !errors.Is(err, failed) || errors.Is(err, refundFailed) {
+		t.Errorf("expected the flow to fail only with %v but got %v", failed, err)
+	}
+	var aggregate *AggregateError
+	if err := flow.CompensationErr(time.Second); !errors.As(err, &aggregate) || !errors.Is(err, refundFailed) {
+		t.Errorf("expected the compensation to fail with %v but got %v", refundFailed, err)
+	}
+}
+
+func TestFlow_WithCompensation_Cancel(t *testing.T) {
+	refunded := make(chan int, 1)
+	flow := NewFlow(func() int {
+		return 100
+	}).WithCompensation(func(amount int) {
+		refunded <- amount
+	}).ThenApply(func(ctx context.Context, amount int) int {
+		<-ctx.Done()
+		return amount
+	})
+
+	flow.Execute()
+	time.Sleep(20 * time.Millisecond)
+	flow.Cancel()
+	if err := flow.CompensationErr(time.Second); err != nil {
+		t.Errorf("expected no compensation error but got %v", err)
+	}
+	select {
+	case amount := <-refunded:
+		if amount != 100 {
+			t.Errorf("expected 100 to be refunded but got %d", amount)
+		}
+	default:
+		t.Errorf("expected the completed step to be compensated after cancel")
+	}
+}
+
+func TestFlow_WithCompensation_CompletesAfterFailure(t *testing.T) {
+	refunded := make(chan int, 1)
+	charging := make(chan struct{})
+	flow := NewFlow(func() int {
+		close(charging)
+		time.Sleep(100 * time.Millisecond) //the payment is still running when the other step fails
+		return 100
+	}).WithCompensation(func(amount int) {
+		refunded <- amount
+	}).AndCall(func() (int, error) {
+		<-charging
+		return 0, errors.New("out of stock")
+	})
+
+	flow.Execute()
+	if _, err := flow.Get(time.Second); err == nil {
+		t.Errorf("expected an error!!!")
+	}
+	if err := flow.CompensationErr(time.Second); err != nil {
+		t.Errorf("expected no compensation error but got %v", err)
+	}
+	select {
+	case amount := <-refunded:
+		if amount != 100 {
+			t.Errorf("expected 100 to be refunded but got %d", amount)
+		}
+	default:
+		t.Errorf("expected the step completing after the failure to be compensated")
+	}
+}
+
+func TestFlow_WithCompensation_Completed(t *testing.T) {
+	flow := NewFlow(func() int {
+		return 1
+	}).WithCompensation(func(int) {
+		t.Errorf("did not expect a compensation for a flow that completed")
+	})
+
+	flow.Execute()
+	if _, err := flow.Get(time.Second); err != nil {
+		t.Errorf("expected no error but got %v", err)
+	}
+	if err := flow.CompensationErr(time.Second); err != nil {
+		t.Errorf("expected no compensation error but got %v", err)
+	}
+
+	invalid := NewFlow(func() int { return 1 }).WithCompensation(func(string) {})
+	if err := invalid.Validate(); err == nil {
+		t.Errorf("expected an error for a compensation not accepting the results of the step")
+	}
+}
+
+func TestFlow_Validate(t *testing.T) {
+	flow := NewFlow(func(ctx context.Context, delay time.Duration) (int, error) {
+		return 1, nil
+	}, time.Duration(10)).AndCall(func(operands ...int) int {
+		return len(operands)
+	}, 1, 2).ThenCombine(func(op1, op2 int) int {
+		return op1 + op2
+	}).AndCall(func(err error) string {
+		return "ok"
+	}, nil).ThenCombine(func(sum int, ok string) bool {
+		return sum == 3 && ok == "ok"
+	})
+
+	if err := flow.Validate(); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	}
+}
+
+func TestFlow_Validate_Mismatch(t *testing.T) {
+	flow := NewFlow(func() (int, error) {
+		return 1, nil
+	}).AndCall(func() string {
+		return "1"
+	}).ThenCombine(func(op1, op2 int) int {
+		return op1 + op2
+	})
+
+	err := flow.Validate()
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Index != 2 || stepErr.Op != COMBINE {
+		t.Fatalf("expected the combine step to be invalid but got %v", err)
+	}
+
+	executed := false
+	flow = NewFlow(func() int {
+		executed = true
+		return 1
+	}).ThenApply(func(op1, op2 int) int {
+		return op1 + op2
+	})
+	flow.Execute()
+	if _, err := flow.Get(0); !errors.As(err, &stepErr) || stepErr.Index != 1 {
+		t.Errorf("expected the apply step to be invalid but got %v", err)
+	}
+	if executed {
+		t.Errorf("did not expect an invalid flow to be executed")
+	}
+}
+
+func TestFlow_Validate_UnsupportedType(t *testing.T) {
+	flow := NewFlow(func() int {
+		return 1
+	}).ThenApply("not a func")
+
+	if err := flow.Validate(); err == nil {
+		t.Errorf("expected an error!!!")
 	}
 }
 
@@ -135,10 +1062,11 @@ func ExampleNewFlow() {
 		})
 
 	newExecutorService := NewExecutorService(10, 5)
+	defer newExecutorService.Shutdown()
 
 	billFlow.SetExecutor(newExecutorService).Execute()
 	if finalAmount, e := billFlow.Get(0); e != nil {
-		fmt.Errorf("error (%s) while waiting to get the final bill amount", e.Error())
+		fmt.Printf("error (%s) while waiting to get the final bill amount\n", e.Error())
 	} else {
 		fmt.Println(finalAmount[0])
 	}
@@ -1,3 +1,3 @@
 module github.com/kartiksirigeri/go-work-flow 
 
-go 1.14
+go 1.18
@@ -0,0 +1,107 @@
+package workflow
+
+import (
+	"fmt"
+)
+
+// Placeholder is an arg of a step that is resolved from the inputs supplied when the flow is executed, see Input().
+type Placeholder struct {
+	key interface{}
+}
+
+// Inputs are the values the placeholders of a flow are resolved from, keyed by the index or the name passed to Input(),
+// e.g. Inputs{0: 42, "customerID": "c-1"}.
+type Inputs map[interface{}]interface{}
+
+// Input returns a placeholder that can be passed as an arg of NewFlow(), AndCall() or Step() instead of a value fixed
+// when the flow is built. key is either the index (int) or the name (string) of the input, the placeholder is resolved
+// from the Inputs passed to ExecuteWith() or RunWith(), the value is validated against the parameter of the target function.
+// An index is resolved from the args passed to Run() or RunWith() as well, see FlowDefinition.RunWith().
+// The flows chosen by a BRANCH step are resolved from the same inputs.
+func Input(key interface{}) Placeholder {
+	return Placeholder{key: key}
+}
+
+func (p Placeholder) String() string {
+	return fmt.Sprintf("Input(%#v)", p.key)
+}
+
+// checkPlaceholders reports if the args have placeholders, returns an error for a placeholder with an un-supported key.
+func checkPlaceholders(args []interface{}) (bool, error) {
+	found := false
+	for _, arg := range args {
+		if p, ok := arg.(Placeholder); ok {
+			switch p.key.(type) {
+			case int, string:
+				found = true
+			default:
+				return false, fmt.Errorf("%T un-supported input key of %s, expected an int or a string", p.key, p)
+			}
+		}
+	}
+	return found, nil
+}
+
+// resolveInputs replaces the placeholders passed to the steps with the inputs, the steps are not shared with other runs.
+func (fl *Flow) resolveInputs() error {
+	for i, s := range fl.steps {
+		if found, err := checkPlaceholders(s.paramsPassed); err != nil || !found {
+			if err != nil {
+				return fl.stepError(i, err)
+			}
+			continue
+		}
+		resolved := make([]interface{}, len(s.paramsPassed))
+		for a, arg := range s.paramsPassed {
+			p, ok := arg.(Placeholder)
+			if !ok {
+				resolved[a] = arg
+				continue
+			}
+			value, supplied := fl.inputs[p.key]
+			if !supplied {
+				return fl.stepError(i, fmt.Errorf("%s is not supplied", p))
+			}
+			resolved[a] = value
+		}
+		s.paramsPassed = resolved
+	}
+	return nil
+}
+
+// indexed reports if a step of the flow, or of a flow chosen by one of its BRANCH steps, is passed an Input(i) placeholder.
+func (fl *Flow) indexed() bool {
+	for _, s := range fl.steps {
+		for _, arg := range s.paramsPassed {
+			if p, ok := arg.(Placeholder); ok {
+				if _, ok := p.key.(int); ok {
+					return true
+				}
+			}
+		}
+		if s.branch == nil {
+			continue
+		}
+		if s.branch.otherwise != nil && s.branch.otherwise.indexed() {
+			return true
+		}
+		for _, flow := range s.branch.cases {
+			if flow != nil && flow.indexed() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withArgs returns the inputs with the i'th arg as the input of the index i, an arg replaces the input of its index.
+func withArgs(inputs Inputs, args []interface{}) Inputs {
+	merged := make(Inputs, len(inputs)+len(args))
+	for key, value := range inputs {
+		merged[key] = value
+	}
+	for i, arg := range args {
+		merged[i] = arg
+	}
+	return merged
+}
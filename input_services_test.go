@@ -0,0 +1,90 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFlow_ExecuteWith(t *testing.T) {
+	flow := NewFlow(func(customerID string) string {
+		return "orders of " + customerID
+	}, Input("customerID")).AndCall(func(limit, offset int) string {
+		return fmt.Sprintf("%d from %d", limit, offset)
+	}, Input(0), 10).ThenCombine(func(orders, page string) string {
+		return orders + " " + page
+	})
+
+	flow.ExecuteWith(Inputs{0: 20, "customerID": "c-1"})
+	if get, err := flow.Get(time.Second); err != nil || get[0] != "orders of c-1 20 from 10" {
+		t.Errorf("expected the inputs to be passed but got %v, %v", get, err)
+	}
+}
+
+func TestFlow_ExecuteWith_Invalid(t *testing.T) {
+	newFlow := func() *Flow {
+		return NewFlow(func(customerID string) string {
+			return customerID
+		}, Input("customerID"))
+	}
+	var stepErr *StepError
+
+	missing := newFlow().Execute()
+	if _, err := missing.Get(time.Second); !errors.As(err, &stepErr) || stepErr.Index != 0 {
+		t.Errorf("expected the missing input to be reported but got %v", err)
+	}
+
+	mismatch := newFlow().ExecuteWith(Inputs{"customerID": 1})
+	if _, err := mismatch.Get(time.Second); !errors.As(err, &stepErr) || stepErr.Index != 0 {
+		t.Errorf("expected the input not matching the parameter to be reported but got %v", err)
+	}
+
+	unsupported := NewFlow(func(string) {}, Input(1.5))
+	if err := unsupported.Validate(); err == nil {
+		t.Errorf("expected an error for an input key that is not an int or a string")
+	}
+}
+
+func TestFlowDefinition_RunWith(t *testing.T) {
+	def, err := NewFlow(func(customerID string) string {
+		return customerID
+	}, Input("customerID")).ThenIf(func(customerID string) bool {
+		return customerID == "vip"
+	}, NewFlow(func(discount int, customerID string) string {
+		return fmt.Sprintf("%s gets %d%%", customerID, discount)
+	}, Input("discount")), nil).Define()
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	vip := def.RunWith(context.Background(), Inputs{"customerID": "vip", "discount": 10})
+	other := def.RunWith(context.Background(), Inputs{"customerID": "c-2"})
+	if get, err := vip.Get(time.Second); err != nil || get[0] != "vip gets 10%" {
+		t.Errorf("expected 'vip gets 10%%' but got %v, %v", get, err)
+	}
+	if get, err := other.Get(time.Second); err != nil || get[0] != "c-2" {
+		t.Errorf("expected 'c-2' but got %v, %v", get, err)
+	}
+}
+
+func TestFlowDefinition_Run_IndexedInput(t *testing.T) {
+	def, err := NewFlow(func(limit, offset int) string {
+		return fmt.Sprintf("%d from %d", limit, offset)
+	}, Input(0), Input(1)).Define()
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	if get, err := def.Run(context.Background(), 20, 10).Get(time.Second); err != nil || get[0] != "20 from 10" {
+		t.Errorf("expected the args of the run to be passed but got %v, %v", get, err)
+	}
+	if get, err := def.RunWith(context.Background(), Inputs{1: 5}, 30).Get(time.Second); err != nil || get[0] != "30 from 5" {
+		t.Errorf("expected the args and the inputs of the run to be passed but got %v, %v", get, err)
+	}
+	var stepErr *StepError
+	if _, err := def.Run(context.Background(), 20).Get(time.Second); !errors.As(err, &stepErr) || stepErr.Index != 0 {
+		t.Errorf("expected the missing input to be reported but got %v", err)
+	}
+}
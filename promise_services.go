@@ -0,0 +1,44 @@
+package workflow
+
+import (
+	"context"
+)
+
+// Promise is completed manually instead of by calling a target function, it bridges callback or channel based
+// APIs into futures and flows. The Future() of a promise behaves exactly like one created by RunAsync(),
+// it can be waited for, cancelled, timed out and awaited by the steps of a Flow.
+type Promise struct {
+	future *Future
+}
+
+// NewPromise creates a promise that is not completed yet.
+func NewPromise() *Promise {
+	return NewPromiseCtx(context.Background())
+}
+
+// Same as NewPromise(), the future of the promise is aborted when the ctx is done.
+func NewPromiseCtx(ctx context.Context) *Promise {
+	future := newFuture(ctx)
+	future.manual = true
+	return &Promise{future: future}
+}
+
+// Complete completes the future of the promise with values as the results.
+// Returns false if the future is done already, i.e. completed, failed, cancelled or timedout.
+func (p *Promise) Complete(values ...interface{}) bool {
+	return p.future.settle(values, nil)
+}
+
+// Fail completes the future of the promise with err, which is returned by Get().
+// Returns false if the future is done already, i.e. completed, failed, cancelled or timedout, or if err is nil.
+func (p *Promise) Fail(err error) bool {
+	if err == nil {
+		return false
+	}
+	return p.future.settle(nil, err)
+}
+
+// Future returns the future that is completed by this promise.
+func (p *Promise) Future() *Future {
+	return p.future
+}
@@ -0,0 +1,128 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPromise_Complete(t *testing.T) {
+	promise := NewPromise()
+	time.AfterFunc(10*time.Millisecond, func() {
+		promise.Complete(2, "two")
+	})
+
+	if get, err := promise.Future().Get(time.Second); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	} else if len(get) != 2 || get[0] != 2 || get[1] != "two" {
+		t.Errorf("expected [2 two] but got %v", get)
+	}
+	if promise.Complete(3) || promise.Fail(errors.New("failed")) {
+		t.Errorf("did not expect a completed promise to be completed again")
+	}
+}
+
+func TestPromise_Fail(t *testing.T) {
+	failed := errors.New("failed")
+	promise := NewPromise()
+	if promise.Fail(nil) {
+		t.Errorf("expected a nil error not to fail the promise")
+	}
+	promise.Fail(failed)
+
+	if _, err := promise.Future().Get(0); err != failed {
+		t.Errorf("expected %v but got %v", failed, err)
+	}
+}
+
+func TestPromise_Cancel(t *testing.T) {
+	promise := NewPromise()
+	promise.Future().Cancel()
+
+	if promise.Complete(2) {
+		t.Errorf("did not expect a cancelled promise to be completed")
+	}
+	if _, err := promise.Future().Get(0); err != ErrAborted {
+		t.Errorf("expected ErrAborted but got %v", err)
+	}
+}
+
+func TestPromise_Get_TimeOut(t *testing.T) {
+	promise := NewPromise()
+
+	if _, err := promise.Future().Get(5 * time.Millisecond); err != ErrTimedOut {
+		t.Errorf("expected ErrTimedOut but got %v", err)
+	}
+	if promise.Future().Stage() != TIMEDOUT {
+		t.Errorf("expected the future to be TIMEDOUT but got %d", promise.Future().Stage())
+	}
+}
+
+func TestPromise_Flow(t *testing.T) {
+	bill := NewPromise()
+	rate := NewPromise()
+	flow := NewFlowFromFuture(bill.Future()).
+		AndAwait(rate.Future()).
+		ThenCombine(func(billAmount, conversionRate int) int {
+			return billAmount * conversionRate
+		})
+
+	flow.Execute()
+	bill.Complete(100)
+	rate.Complete(60)
+	if get, err := flow.Get(time.Second); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	} else if get[0] != 6000 {
+		t.Errorf("expected 6000 but got %v", get[0])
+	}
+}
+
+func TestPromise_Flow_ArgsMismatch(t *testing.T) {
+	promise := NewPromise()
+	flow := NewFlowFromFuture(promise.Future()).ThenApply(func(s string) string {
+		return s
+	})
+
+	flow.Execute()
+	promise.Complete(1)
+	_, err := flow.Get(time.Second)
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Index != 1 {
+		t.Errorf("expected step 1 to fail with a StepError but got %v", err)
+	}
+}
+
+func TestPromise_Flow_StepTimeOut(t *testing.T) {
+	promise := NewPromise()
+	flow := NewFlowFromFuture(promise.Future()).WithStepTimeout(10 * time.Millisecond)
+
+	flow.Execute()
+	if _, err := flow.Get(time.Second); err == nil {
+		t.Errorf("expected the step awaiting the promise to time out")
+	}
+	if !promise.Complete(1) {
+		t.Errorf("expected the promise not to be done by the timeout of the step")
+	}
+	if get, err := promise.Future().Get(0); err != nil || get[0] != 1 {
+		t.Errorf("expected the future of the promise to complete with 1 but got %v, %v", get, err)
+	}
+}
+
+func ExamplePromise() {
+	promise := NewPromise()
+	callbackAPI := func(onDone func(amount int)) {
+		go onDone(100)
+	}
+
+	callbackAPI(func(amount int) {
+		promise.Complete(amount)
+	})
+
+	if amount, e := promise.Future().Get(time.Second); e == nil {
+		fmt.Println(amount[0])
+	}
+
+	//// Output:
+	//// 100
+}
@@ -0,0 +1,119 @@
+package workflow
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// StepResult is the outcome of a step of a flow, see Results().
+type StepResult struct {
+	Index    int
+	Name     string //name given to the step, see Named()
+	Op       OpType
+	Stage    FutureStage //NOT_STARTED if the step is not started, e.g. it is skipped after a step failed
+	Values   []interface{}
+	Err      error
+	Attempts int
+	Started  time.Time //zero if the step is not started
+	Finished time.Time //zero if the step is not done
+}
+
+// Duration returns how long the step ran, zero if it is not done.
+func (r StepResult) Duration() time.Duration {
+	if r.Finished.IsZero() {
+		return 0
+	}
+	return r.Finished.Sub(r.Started)
+}
+
+// outcome is recorded by a run of the flow for a step.
+type outcome struct {
+	started  time.Time
+	finished time.Time
+	values   []interface{}
+	err      error
+	recorded bool //the values and err of the step were consumed by the flow
+}
+
+// record keeps the values passed on by the i'th step, or the error it failed with.
+func (fl *Flow) record(i int, values []interface{}, err error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	s := fl.steps[i]
+	s.outcome.values, s.outcome.err, s.outcome.recorded = values, err, true
+}
+
+// recordFolded records that the i'th step completed without keeping its values, which are only folded by REDUCE steps.
+// The values held by the future of the step are released as well.
+func (fl *Flow) recordFolded(i int) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	s := fl.steps[i]
+	s.outcome.values, s.outcome.err, s.outcome.recorded = nil, nil, true
+	s.future.release()
+}
+
+// Results returns the outcome of every step of the flow, in the order the steps are added, with the values each step
+// passed on or the error it failed with. It can be called while the flow is running or after it failed,
+// the steps that are not done have no values yet. The values of a step used only by ThenReduce() or ThenCollect()
+// steps are not kept once they are folded, only its stage and timings are reported.
+func (fl *Flow) Results() []StepResult {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	results := make([]StepResult, len(fl.steps))
+	for i := range fl.steps {
+		results[i] = fl.stepResult(i)
+	}
+	return results
+}
+
+// StepResult returns the outcome of the step with the name, see Named(), an error if the flow has no such step.
+func (fl *Flow) StepResult(name string) (StepResult, error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+	for i, s := range fl.steps {
+		if s.name == name {
+			return fl.stepResult(i), nil
+		}
+	}
+	return StepResult{}, fmt.Errorf("flow has no step named %q", name)
+}
+
+func (fl *Flow) stepResult(i int) StepResult {
+	s := fl.steps[i]
+	result := StepResult{
+		Index:    i,
+		Name:     s.name,
+		Op:       s.op,
+		Stage:    NOT_STARTED,
+		Values:   s.outcome.values,
+		Err:      s.outcome.err,
+		Attempts: int(atomic.LoadInt32(&s.attempts)),
+		Started:  s.outcome.started,
+		Finished: s.outcome.finished,
+	}
+	if s.future == nil {
+		return result
+	}
+	result.Stage = s.future.Stage()
+	if !s.outcome.recorded {
+		//the step completed after the flow stopped waiting for it, e.g. because another step failed
+		if result.Err = s.future.Err(); result.Err == nil && s.returnsTarget() {
+			result.Values, result.Err = splitError(s.targetFunc, s.future.Result())
+		} else if result.Err == nil {
+			result.Values = s.future.Result()
+		}
+	}
+	return result
+}
+
+// Results is same as *Flow.Results() for the run.
+func (r *FlowRun) Results() []StepResult {
+	return r.flow.Results()
+}
+
+// StepResult is same as *Flow.StepResult() for the run.
+func (r *FlowRun) StepResult(name string) (StepResult, error) {
+	return r.flow.StepResult(name)
+}
@@ -0,0 +1,91 @@
+package workflow
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFlow_Results(t *testing.T) {
+	flow := NewFlow(func() int {
+		time.Sleep(10 * time.Millisecond)
+		return 100
+	}).Named("bill").AndCall(func() int {
+		return 60
+	}).Named("rate").ThenCombine(func(bill, rate int) int {
+		return bill * rate
+	})
+
+	flow.Execute()
+	if _, err := flow.Get(time.Second); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	results := flow.Results()
+	if len(results) != 3 {
+		t.Fatalf("expected the results of 3 steps but got %d", len(results))
+	}
+	for i, expected := range []int{100, 60, 6000} {
+		result := results[i]
+		if result.Index != i || result.Stage != COMPLETED || result.Err != nil || len(result.Values) != 1 || result.Values[0] != expected {
+			t.Errorf("expected step %d to complete with %d but got %+v", i, expected, result)
+		}
+	}
+	if bill := results[0]; bill.Name != "bill" || bill.Duration() < 10*time.Millisecond || bill.Attempts != 1 {
+		t.Errorf("expected the bill step to take at least 10ms but got %+v", bill)
+	}
+}
+
+func TestFlow_StepResult_PartialFailure(t *testing.T) {
+	failed := errors.New("failed")
+	flow := NewFlow(func() int {
+		return 100
+	}).Named("bill").ThenApply(func(int) (int, error) {
+		return 0, failed
+	}).Named("convert").ThenApply(func(int) int {
+		return 1
+	}).Named("format")
+
+	flow.Execute()
+	if _, err := flow.Get(time.Second); !errors.Is(err, failed) {
+		t.Fatalf("expected the flow to fail with %v but got %v", failed, err)
+	}
+	if bill, err := flow.StepResult("bill"); err != nil || bill.Stage != COMPLETED || bill.Values[0] != 100 {
+		t.Errorf("expected the bill amount to be kept but got %+v, %v", bill, err)
+	}
+	if convert, err := flow.StepResult("convert"); err != nil || !errors.Is(convert.Err, failed) || convert.Values != nil {
+		t.Errorf("expected the convert step to fail with %v but got %+v, %v", failed, convert, err)
+	}
+	if format, err := flow.StepResult("format"); err != nil || format.Stage != NOT_STARTED || !format.Started.IsZero() {
+		t.Errorf("expected the format step not to be started but got %+v, %v", format, err)
+	}
+	if _, err := flow.StepResult("unknown"); err == nil {
+		t.Errorf("expected an error for a step that does not exist")
+	}
+}
+
+func TestFlow_Results_FoldedNotKept(t *testing.T) {
+	flow := NewFlow(func() []int {
+		return make([]int, 1000)
+	}).AndCall(func() []int {
+		return make([]int, 1000)
+	}).ThenReduce(0, func(total int, items []int) int {
+		return total + len(items)
+	})
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != 2000 {
+		t.Fatalf("expected 2000 but got %v, %v", get, err)
+	}
+	results := flow.Results()
+	for _, folded := range results[:2] {
+		if folded.Stage != COMPLETED || folded.Values != nil {
+			t.Errorf("expected step %d to complete without keeping its values but got %+v", folded.Index, folded)
+		}
+		if flow.steps[folded.Index].future.Result() != nil {
+			t.Errorf("expected the future of step %d to release its values", folded.Index)
+		}
+	}
+	if reduced := results[2]; len(reduced.Values) != 1 || reduced.Values[0] != 2000 {
+		t.Errorf("expected the values of the REDUCE step to be kept but got %+v", reduced)
+	}
+}
@@ -0,0 +1,61 @@
+package workflow
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff returns how long to wait before the next attempt, attempt is the number of the attempt that failed starting at 1.
+type Backoff func(attempt int) time.Duration
+
+// ConstantBackoff waits the same delay before every retry.
+func ConstantBackoff(delay time.Duration) Backoff {
+	return func(int) time.Duration {
+		return delay
+	}
+}
+
+// ExponentialBackoff doubles the delay after every failed attempt starting with initial, the delay never exceeds max.
+func ExponentialBackoff(initial, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		delay := initial
+		for i := 1; i < attempt && delay < max; i++ {
+			delay *= 2
+		}
+		if delay > max {
+			delay = max
+		}
+		return delay
+	}
+}
+
+// JitterBackoff waits a random delay between 0 and the delay of ExponentialBackoff(), so retries of concurrent
+// flows do not hit a failing service at the same time.
+func JitterBackoff(initial, max time.Duration) Backoff {
+	exponential := ExponentialBackoff(initial, max)
+	return func(attempt int) time.Duration {
+		delay := exponential(attempt)
+		if delay <= 0 {
+			return 0
+		}
+		return time.Duration(rand.Int63n(int64(delay) + 1))
+	}
+}
+
+type retryPolicy struct {
+	maxAttempts int
+	backoff     Backoff
+	retryable   func(error) bool
+}
+
+// retries reports if another attempt is made after the attempt failed with err.
+func (r *retryPolicy) retries(attempt int, err error) bool {
+	return attempt < r.maxAttempts && (r.retryable == nil || r.retryable(err))
+}
+
+func (r *retryPolicy) delay(attempt int) time.Duration {
+	if r.backoff == nil {
+		return 0
+	}
+	return r.backoff(attempt)
+}
@@ -0,0 +1,34 @@
+package workflow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConstantBackoff(t *testing.T) {
+	backoff := ConstantBackoff(10 * time.Millisecond)
+	for attempt := 1; attempt < 4; attempt++ {
+		if delay := backoff(attempt); delay != 10*time.Millisecond {
+			t.Errorf("expected 10ms for attempt %d but got %v", attempt, delay)
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+	expected := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond, 50 * time.Millisecond}
+	for i, want := range expected {
+		if delay := backoff(i + 1); delay != want {
+			t.Errorf("expected %v for attempt %d but got %v", want, i+1, delay)
+		}
+	}
+}
+
+func TestJitterBackoff(t *testing.T) {
+	backoff := JitterBackoff(10*time.Millisecond, 50*time.Millisecond)
+	for attempt := 1; attempt < 10; attempt++ {
+		if delay := backoff(attempt); delay < 0 || delay > 50*time.Millisecond {
+			t.Errorf("expected a delay between 0 and 50ms for attempt %d but got %v", attempt, delay)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package workflow
+
+import (
+	"context"
+	"reflect"
+	"sync"
+)
+
+// FlowState is a key/value store shared by the steps of a single run of a flow, e.g. for correlation IDs, caches
+// and metadata accumulated by steps that do not pass results to each other. It is safe for concurrent use.
+// A target function gets the state of its flow by declaring a *FlowState parameter, first or right after the
+// context.Context, which is passed like the context.Context when it is not part of the args.
+// The flows chosen by a BRANCH step share the state of the flow running them.
+type FlowState struct {
+	mu     sync.RWMutex
+	values map[string]interface{}
+}
+
+type flowStateKey struct{}
+
+var flowStateType = reflect.TypeOf((*FlowState)(nil))
+
+func newFlowState() *FlowState {
+	return &FlowState{values: make(map[string]interface{})}
+}
+
+// Get returns the value of the key, false if the key is not set.
+func (s *FlowState) Get(key string) (interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, found := s.values[key]
+	return value, found
+}
+
+// Set sets the value of the key, replacing the value set before.
+func (s *FlowState) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+}
+
+// Delete removes the key.
+func (s *FlowState) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+}
+
+// Update sets the key to the value returned by fn, which is called with the current value of the key, false if it
+// is not set. No other change is made to the state while fn runs, so steps can accumulate values without losing updates.
+func (s *FlowState) Update(key string, fn func(value interface{}, found bool) interface{}) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, found := s.values[key]
+	value = fn(value, found)
+	s.values[key] = value
+	return value
+}
+
+// Values returns a copy of the keys and values in the state.
+func (s *FlowState) Values() map[string]interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	values := make(map[string]interface{}, len(s.values))
+	for key, value := range s.values {
+		values[key] = value
+	}
+	return values
+}
+
+// stateOf returns the state carried by the ctx, nil if the ctx is not the ctx of a flow.
+func stateOf(ctx context.Context) *FlowState {
+	state, _ := ctx.Value(flowStateKey{}).(*FlowState)
+	return state
+}
+
+// injectsState reports if a *FlowState has to be passed to the target function, which is the case when the parameter
+// after the injected context.Context, or the first one, is a *FlowState and it is not part of the arguments passed.
+// A nil entry in argTypes represents an untyped nil argument.
+func injectsState(targetType reflect.Type, argTypes []reflect.Type) bool {
+	p := 0
+	if injectsContext(targetType, argTypes) {
+		p = 1
+	} else if targetType.NumIn() > 0 && targetType.In(0) == contextType {
+		return false //the context.Context is passed in the args, so is the state
+	}
+	if targetType.NumIn() <= p || targetType.In(p) != flowStateType {
+		return false
+	}
+	if len(argTypes) == 0 {
+		return true
+	}
+	if argTypes[0] == flowStateType {
+		return false
+	}
+	return !(argTypes[0] == nil && len(argTypes) == targetType.NumIn()-p)
+}
+
+// initCtx sets the ctx of the flow derived from ctx, carrying the state shared by its steps, a new one if state is nil.
+func (fl *Flow) initCtx(ctx context.Context, state *FlowState) {
+	if state == nil {
+		state = newFlowState()
+	}
+	fl.state = state
+	fl.ctx, fl.cancelCtx = context.WithCancel(context.WithValue(ctx, flowStateKey{}, state))
+}
+
+// stateCtx returns a ctx carrying the state of the flow for the functions called once the flow is done.
+func (fl *Flow) stateCtx() context.Context {
+	return context.WithValue(context.Background(), flowStateKey{}, fl.state)
+}
+
+// State returns the state shared by the steps of the flow, values set before Execute() are seen by the steps.
+func (fl *Flow) State() *FlowState {
+	return fl.state
+}
+
+// State is same as *Flow.State() for the run.
+func (r *FlowRun) State() *FlowState {
+	return r.flow.State()
+}
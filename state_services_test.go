@@ -0,0 +1,102 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFlow_State(t *testing.T) {
+	flow := NewFlow(func(ctx context.Context, state *FlowState, orderID string) string {
+		state.Set("correlationID", "corr-"+orderID)
+		return orderID
+	}, "o-1").ThenApply(func(orderID string) int {
+		return len(orderID)
+	}).ThenApply(func(state *FlowState, n int) string {
+		correlationID, _ := state.Get("correlationID")
+		return fmt.Sprintf("%v %d", correlationID, n)
+	})
+
+	flow.Execute()
+	if get, err := flow.Get(time.Second); err != nil || get[0] != "corr-o-1 3" {
+		t.Errorf("expected the correlation ID to be shared but got %v, %v", get, err)
+	}
+	if correlationID, found := flow.State().Get("correlationID"); !found || correlationID != "corr-o-1" {
+		t.Errorf("expected the state to be visible after the flow but got %v", correlationID)
+	}
+}
+
+func TestFlow_State_Concurrent(t *testing.T) {
+	count := func(state *FlowState) {
+		state.Update("calls", func(value interface{}, found bool) interface{} {
+			if !found {
+				return 1
+			}
+			return value.(int) + 1
+		})
+	}
+	flow := NewFlow(func() []int {
+		return []int{1, 2, 3}
+	}).AndCall(count).AndCall(count).ThenCombine(func(items []int) []int {
+		return items
+	}).ThenMap(func(state *FlowState, n int) int {
+		count(state)
+		return n
+	}, 0)
+	flow.Execute()
+	if _, err := flow.Get(time.Second); err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if calls, _ := flow.State().Get("calls"); calls != 5 {
+		t.Errorf("expected 5 calls to be counted but got %v", calls)
+	}
+}
+
+func TestFlowDefinition_Run_State(t *testing.T) {
+	es := NewExecutorService(100, 40)
+	defer es.Shutdown()
+	def, err := NewFlow(func(state *FlowState, id int) int {
+		state.Set("id", id)
+		return id
+	}).ThenIf(func(id int) bool {
+		return id%2 == 0
+	}, NewFlow(func(state *FlowState, id int) int {
+		seen, _ := state.Get("id")
+		return seen.(int) * 10
+	}), nil).SetExecutor(es).Define()
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for id := 0; id < 10; id++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			expected := id
+			if id%2 == 0 {
+				expected = id * 10
+			}
+			if get, err := def.Run(context.Background(), id).Get(time.Second); err != nil || get[0] != expected {
+				t.Errorf("expected %d from the state of run %d but got %v, %v", expected, id, get, err)
+			}
+		}(id)
+	}
+	wg.Wait()
+}
+
+func TestRunAsync_State(t *testing.T) {
+	future, err := RunAsync(func(state *FlowState, n int) int {
+		state.Set("n", n)
+		value, _ := state.Get("n")
+		return value.(int)
+	}, 7)
+	if err != nil {
+		t.Fatalf("expected no error but got %v", err)
+	}
+	if get, err := future.Execute().Get(time.Second); err != nil || get[0] != 7 {
+		t.Errorf("expected 7 but got %v, %v", get, err)
+	}
+}
@@ -0,0 +1,210 @@
+package workflow
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// TypedFuture is the type-safe counterpart of Future, it represents the async execution of a target function returning (T, error).
+// It is built on the same Future and ExecutorService, the compiler checks that the steps chained using Then() and Combine2()
+// accept the results of the previous steps.
+type TypedFuture[T any] struct {
+	future *Future
+}
+
+// Async creates a TypedFuture that represents the async execution of the target function.
+// Execute() should be called on the returned future to trigger the execution of the target function.
+func Async[T any](targetFunc func() (T, error)) *TypedFuture[T] {
+	return AsyncCtx(context.Background(), func(context.Context) (T, error) {
+		return targetFunc()
+	})
+}
+
+// Same as Async(), the target function is passed a context derived from ctx,
+// which is cancelled when the future is cancelled or timedout.
+func AsyncCtx[T any](ctx context.Context, targetFunc func(context.Context) (T, error)) *TypedFuture[T] {
+	future, _ := RunAsyncCtx(ctx, targetFunc)
+	return &TypedFuture[T]{future: future}
+}
+
+// Then creates a TypedFuture whose target function is called with the result of prev once it is completed.
+// The returned future fails with the error of prev without calling the target function, if prev fails.
+// Execute() on the returned future triggers the execution of prev as well.
+func Then[T, U any](prev *TypedFuture[T], targetFunc func(T) (U, error)) *TypedFuture[U] {
+	return &TypedFuture[U]{future: prev.future.chain(targetFunc, func(done *Future, targetType reflect.Type) ([]interface{}, bool) {
+		if typedFailed(done) {
+			return nil, false
+		}
+		return done.funcReturned[:1], true
+	})}
+}
+
+// Combine2 creates a TypedFuture whose target function is called with the results of a and b once both are completed.
+// Execute() on the returned future triggers the execution of a and b as well.
+func Combine2[A, B, R any](a *TypedFuture[A], b *TypedFuture[B], targetFunc func(A, B) (R, error)) *TypedFuture[R] {
+	return &TypedFuture[R]{future: combine(targetFunc, a.future, b.future)}
+}
+
+// Combine3 is same as Combine2() for three futures.
+func Combine3[A, B, C, R any](a *TypedFuture[A], b *TypedFuture[B], c *TypedFuture[C], targetFunc func(A, B, C) (R, error)) *TypedFuture[R] {
+	return &TypedFuture[R]{future: combine(targetFunc, a.future, b.future, c.future)}
+}
+
+// combine creates a future whose target function is submitted with the result of each of the futures once all of them
+// completed, like chain() does for a single future. It fails with the first of the futures to fail, without waiting
+// for the others.
+func combine(targetFunc interface{}, futures ...*Future) *Future {
+	next := newFuture(futures[0].parentCtx)
+	next.es = futures[0].es
+	next.deps = futures
+	next.targetFunc = targetFunc
+	next.detached = true
+	next.trigger = func() {
+		pending := int32(len(futures))
+		for _, f := range futures {
+			f := f
+			f.whenDone(func() {
+				if typedFailed(f) {
+					next.adopt(f)
+					return
+				}
+				if atomic.AddInt32(&pending, -1) > 0 {
+					return
+				}
+				args := make([]interface{}, 0, len(futures))
+				for _, f := range futures {
+					args = append(args, f.funcReturned[0])
+				}
+				next.paramsPassed = args
+				next.submit()
+			})
+		}
+	}
+	return next
+}
+
+// typedFailed reports if the future of a TypedFuture, which is done, failed or its target function returned a non-nil error.
+func typedFailed(f *Future) bool {
+	return f.err != nil || f.funcReturned[1] != nil
+}
+
+func (tf *TypedFuture[T]) SetExecutor(customExecutor *ExecutorService) *TypedFuture[T] {
+	tf.future.SetExecutor(customExecutor)
+	return tf
+}
+
+// This has to be called to trigger the execution of the target function, and the futures it depends on, by a GOROUTINE.
+func (tf *TypedFuture[T]) Execute() *TypedFuture[T] {
+	tf.future.Execute()
+	return tf
+}
+
+// Call to Get() blocks until the target function invocation is completed, see Future.Get().
+// The error returned by the target function is returned as is.
+func (tf *TypedFuture[T]) Get(timeout time.Duration) (T, error) {
+	return tf.result(tf.future.Get(timeout))
+}
+
+// GetCtx is same as Get() but waits until the ctx is done instead of a timeout.
+func (tf *TypedFuture[T]) GetCtx(ctx context.Context) (T, error) {
+	return tf.result(tf.future.GetCtx(ctx))
+}
+
+func (tf *TypedFuture[T]) result(get []interface{}, e error) (T, error) {
+	var zero T
+	if e != nil {
+		return zero, e
+	}
+	if get[1] != nil {
+		return zero, get[1].(error)
+	}
+	res, _ := get[0].(T)
+	return res, nil
+}
+
+// Cancel's the referred future, see Future.Cancel().
+func (tf *TypedFuture[T]) Cancel() bool {
+	return tf.future.Cancel()
+}
+
+func (tf *TypedFuture[T]) Stage() FutureStage {
+	return tf.future.Stage()
+}
+
+// Future returns the untyped Future backing this future.
+func (tf *TypedFuture[T]) Future() *Future {
+	return tf.future
+}
+
+// TypedFlow is the type-safe counterpart of Flow, its last step passes on a value of type T.
+// It is built on the same Flow, the compiler checks that the steps added using ThenApply() and ThenCombine()
+// accept the value passed on by the previous steps.
+type TypedFlow[T any] struct {
+	flow *Flow
+}
+
+// NewTypedFlow creates a TypedFlow whose first step calls the target function, see NewFlow().
+func NewTypedFlow[T any](targetFunc func() (T, error)) *TypedFlow[T] {
+	return &TypedFlow[T]{flow: NewFlow(targetFunc)}
+}
+
+// Same as NewTypedFlow(), the target function is passed a context derived from ctx,
+// which is cancelled when the flow is cancelled or timedout, see NewFlowCtx().
+func NewTypedFlowCtx[T any](ctx context.Context, targetFunc func(context.Context) (T, error)) *TypedFlow[T] {
+	return &TypedFlow[T]{flow: NewFlowCtx(ctx, targetFunc)}
+}
+
+// ThenApply adds a step to the flow whose target function is called with the value passed on by the last step of prev,
+// see Flow.ThenApply().
+func ThenApply[T, U any](prev *TypedFlow[T], targetFunc func(T) (U, error)) *TypedFlow[U] {
+	return &TypedFlow[U]{flow: prev.flow.ThenApply(targetFunc)}
+}
+
+// ThenCombine adds an independent step calling other, see Flow.AndCall(), and a step whose target function is called
+// with the values passed on by the last step of prev and by other, see Flow.ThenCombine().
+func ThenCombine[A, B, R any](prev *TypedFlow[A], other func() (B, error), targetFunc func(A, B) (R, error)) *TypedFlow[R] {
+	return &TypedFlow[R]{flow: prev.flow.AndCall(other).ThenCombine(targetFunc)}
+}
+
+func (tf *TypedFlow[T]) SetExecutor(customExecutor *ExecutorService) *TypedFlow[T] {
+	tf.flow.SetExecutor(customExecutor)
+	return tf
+}
+
+// This has to be called to trigger the execution of the steps of the flow, see Flow.Execute().
+func (tf *TypedFlow[T]) Execute() *TypedFlow[T] {
+	tf.flow.Execute()
+	return tf
+}
+
+// Call to Get() blocks until the steps of the flow are completed, see Flow.Get().
+// The error returned by the target function of a step is wrapped in a *StepError.
+func (tf *TypedFlow[T]) Get(timeout time.Duration) (T, error) {
+	return tf.result(tf.flow.Get(timeout))
+}
+
+// GetCtx is same as Get() but waits until the ctx is done instead of a timeout, see Flow.GetCtx().
+func (tf *TypedFlow[T]) GetCtx(ctx context.Context) (T, error) {
+	return tf.result(tf.flow.GetCtx(ctx))
+}
+
+func (tf *TypedFlow[T]) result(get []interface{}, e error) (T, error) {
+	var zero T
+	if e != nil {
+		return zero, e
+	}
+	res, _ := get[0].(T)
+	return res, nil
+}
+
+// Cancel's the referred flow, see Flow.Cancel().
+func (tf *TypedFlow[T]) Cancel() {
+	tf.flow.Cancel()
+}
+
+// Flow returns the untyped Flow backing this flow.
+func (tf *TypedFlow[T]) Flow() *Flow {
+	return tf.flow
+}
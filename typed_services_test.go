@@ -0,0 +1,156 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestThen(t *testing.T) {
+	toTest := Then(Async(func() (int, error) {
+		return 2, nil
+	}), func(cnt int) (string, error) {
+		return strconv.Itoa(cnt * 2), nil
+	})
+
+	if got, err := toTest.Execute().Get(time.Second); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	} else if got != "4" {
+		t.Errorf("expected 4 but got %s", got)
+	}
+}
+
+func TestThen_PreviousFailed(t *testing.T) {
+	failed := errors.New("failed")
+	called := false
+	toTest := Then(Async(func() (int, error) {
+		return 0, failed
+	}), func(cnt int) (int, error) {
+		called = true
+		return cnt, nil
+	})
+
+	if _, err := toTest.Execute().Get(time.Second); err != failed {
+		t.Errorf("expected the error of the previous future but got %v", err)
+	}
+	if called {
+		t.Errorf("did not expect the target function to be called")
+	}
+}
+
+func TestCombine2(t *testing.T) {
+	bill := Async(func() (int, error) {
+		return 100, nil
+	})
+	rate := Async(func() (float64, error) {
+		return 0.5, nil
+	})
+	toTest := Combine2(bill, rate, func(amount int, conversionRate float64) (float64, error) {
+		return float64(amount) * conversionRate, nil
+	})
+
+	if got, err := toTest.Execute().Get(time.Second); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	} else if got != 50 {
+		t.Errorf("expected 50 but got %f", got)
+	}
+}
+
+func TestTypedFuture_Get_TimeOut(t *testing.T) {
+	toTest := Async(func() (bool, error) {
+		time.Sleep(100 * time.Millisecond)
+		return true, nil
+	})
+
+	if _, err := toTest.Execute().Get(5 * time.Millisecond); err == nil {
+		t.Errorf("expected an error!!!")
+	}
+}
+
+func ExampleCombine2() {
+	getBillAmount := Async(func() (int, error) {
+		time.Sleep(30 * time.Millisecond) //simulate blocking call
+		return 100, nil
+	})
+
+	getDollarValue := Async(func() (int, error) {
+		time.Sleep(30 * time.Millisecond) //simulate blocking call
+		return 60, nil
+	})
+
+	billInDollars := Combine2(getBillAmount, getDollarValue, func(billAmount, conversionRate int) (int, error) {
+		return billAmount * conversionRate, nil
+	})
+
+	billFlow := Then(billInDollars, func(finalAmount int) (string, error) {
+		return fmt.Sprintf("Bill Amount = %d$", finalAmount), nil
+	})
+
+	if finalAmount, e := billFlow.Execute().Get(0); e == nil {
+		fmt.Println(finalAmount)
+	}
+
+	//// Output:
+	//// Bill Amount = 6000$
+}
+
+func TestCombine2_SingleWorker(t *testing.T) {
+	es := NewExecutorService(10, 1)
+	defer es.Shutdown()
+	bill := Async(func() (int, error) {
+		return 100, nil
+	}).SetExecutor(es)
+	rate := Async(func() (int, error) {
+		return 60, nil
+	}).SetExecutor(es)
+	toTest := Then(Combine2(bill, rate, func(amount, conversionRate int) (int, error) {
+		return amount * conversionRate, nil
+	}).SetExecutor(es), func(amount int) (string, error) {
+		return fmt.Sprintf("%d$", amount), nil
+	})
+
+	if got, err := toTest.Execute().Get(time.Second); err != nil || got != "6000$" {
+		t.Errorf("expected 6000$ on a single worker but got %s, %v", got, err)
+	}
+}
+
+func TestTypedFlow(t *testing.T) {
+	toTest := ThenApply(ThenCombine(NewTypedFlow(func() (int, error) {
+		return 100, nil
+	}), func() (float64, error) {
+		return 0.5, nil
+	}, func(amount int, conversionRate float64) (float64, error) {
+		return float64(amount) * conversionRate, nil
+	}), func(amount float64) (string, error) {
+		return fmt.Sprintf("%.0f$", amount), nil
+	})
+
+	if err := toTest.Flow().Validate(); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	}
+	if got, err := toTest.Execute().Get(time.Second); err != nil {
+		t.Errorf("did not expect an error (%s)", err.Error())
+	} else if got != "50$" {
+		t.Errorf("expected 50$ but got %s", got)
+	}
+}
+
+func TestTypedFlow_StepFailed(t *testing.T) {
+	failed := errors.New("failed")
+	called := false
+	toTest := ThenApply(NewTypedFlow(func() (int, error) {
+		return 0, failed
+	}), func(cnt int) (int, error) {
+		called = true
+		return cnt, nil
+	})
+
+	if _, err := toTest.Execute().Get(time.Second); !errors.Is(err, failed) {
+		t.Errorf("expected the error of the first step but got %v", err)
+	}
+	if called {
+		t.Errorf("did not expect the target function to be called")
+	}
+}